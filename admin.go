@@ -0,0 +1,151 @@
+package log4g
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminHandler returns an http.Handler to inspect and control l at runtime,
+// or the default logger if l is nil. Mount it on a debug port:
+//
+//	http.Handle("/debug/log4g/", http.StripPrefix("/debug/log4g", log4g.AdminHandler(nil)))
+//
+// It serves
+//
+//	GET  /                 the config, with secrets redacted, the levels and
+//	                       the health of the items
+//	PUT  /level?level=...  the level of the logger, of the named logger
+//	                       given by logger=..., or of its item given by
+//	                       item=..., for the duration given by ttl=... if any
+//	POST /flush            flush the items
+//	POST /reopen           reopen the files of the items
+func AdminHandler(l *Logger) http.Handler {
+	if l == nil {
+		l = exportLoggers
+	}
+	return &adminHandler{l}
+}
+
+type adminHandler struct {
+	l *Logger
+}
+
+type adminStatus struct {
+	Level   Level                   `json:"level"`
+	Items   []adminItem             `json:"items"`
+	Loggers map[string]*adminStatus `json:"loggers,omitempty"`
+	Config  *Config                 `json:"config,omitempty"`
+}
+
+type adminItem struct {
+	Name   string     `json:"name,omitempty"`
+	Output string     `json:"output,omitempty"`
+	Ref    string     `json:"ref,omitempty"`
+	Level  Level      `json:"level"`
+	Health ItemHealth `json:"health"`
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		status := h.l.status()
+		h.l.rw.RLock()
+		status.Config = h.l.config.redacted()
+		h.l.rw.RUnlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	case path == "level" && r.Method == http.MethodPut:
+		h.setLevel(w, r)
+	case path == "flush" && r.Method == http.MethodPost:
+		h.l.Flush()
+	case path == "reopen" && r.Method == http.MethodPost:
+		if err := h.l.Reopen(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *adminHandler) setLevel(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var level Level
+	if err := level.Set(q.Get("level")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if s := q.Get("ttl"); s != "" {
+		var err error
+		if ttl, err = time.ParseDuration(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := h.l.setLevel(q.Get("logger"), q.Get("item"), level, ttl); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
+// setLevel sets the level of the logger named name, or of l if name is
+// empty, or of its item named item if not empty.
+func (l *Logger) setLevel(name string, item string, level Level, ttl time.Duration) error {
+	target := l
+	if name != "" {
+		if !l.hasNamed(name) {
+			return fmt.Errorf("log4g: no logger named %s", name)
+		}
+		target = l.Named(name)
+	}
+	if item == "" {
+		target.SetLevelFor(level, ttl)
+		return nil
+	}
+	target.rw.RLock()
+	defer target.rw.RUnlock()
+	it, ok := target.named[item].(interface {
+		SetLevelFor(level Level, ttl time.Duration)
+	})
+	if !ok || target.shared {
+		return fmt.Errorf("log4g: no item named %s", item)
+	}
+	it.SetLevelFor(level, ttl)
+	return nil
+}
+
+// hasNamed reports whether the named logger exists or is declared.
+func (l *Logger) hasNamed(name string) bool {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	l.mu.Lock()
+	_, ok := l.children[name]
+	l.mu.Unlock()
+	if ok {
+		return true
+	}
+	_, ok = l.config.Loggers[name]
+	return ok
+}
+
+func (l *Logger) status() *adminStatus {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	status := &adminStatus{Level: l.getLevel()}
+	for i, item := range l.items {
+		lc := l.itemConfs[i]
+		status.Items = append(status.Items, adminItem{lc.Name, lc.Output, lc.Ref, item.GetLevel(), l.health[i].report()})
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, child := range l.children {
+		if status.Loggers == nil {
+			status.Loggers = make(map[string]*adminStatus)
+		}
+		status.Loggers[name] = child.status()
+	}
+	return status
+}
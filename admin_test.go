@@ -0,0 +1,118 @@
+package log4g
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFileLogger returns a logger of config whose items write to the file
+// named out in a temporary directory, and a function reading that file.
+func newFileLogger(t *testing.T, config string) (*Logger, func() string, func()) {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.log")
+	config = strings.Replace(config, "$OUT", filepath.ToSlash(out), -1)
+	filename := filepath.Join(dir, "log4g.json")
+	if err := ioutil.WriteFile(filename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := NewLogger(filename)
+	read := func() string {
+		l.Flush()
+		data, _ := ioutil.ReadFile(out)
+		return string(data)
+	}
+	return l, read, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func putLevel(t *testing.T, server *httptest.Server, query string) {
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/level?"+query, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /level?%s: %s", query, resp.Status)
+	}
+}
+
+func TestAdminLevel(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"level": "info", "items": [{"output": "file", "filename": "$OUT"}]}`)
+	defer cleanup()
+	server := httptest.NewServer(AdminHandler(l))
+	defer server.Close()
+
+	put := func(query string) { putLevel(t, server, query) }
+
+	l.Debug("hidden")
+	put("level=DEBUG")
+	l.Debug("raised")
+	put("level=ERROR")
+	l.Warn("lowered")
+	l.Error("kept")
+
+	got := read()
+	for _, s := range []string{"raised", "kept"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not written:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{"hidden", "lowered"} {
+		if strings.Contains(got, s) {
+			t.Errorf("%q written:\n%s", s, got)
+		}
+	}
+	if !l.IsErrorEnabled() || l.IsWarnEnabled() {
+		t.Error("IsLevel ignores the logger level")
+	}
+}
+
+func TestAdminItemLevel(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"level": "info", "items": [
+		{"name": "a", "output": "file", "filename": "$OUT", "prefix": "[a] "},
+		{"name": "b", "output": "file", "filename": "$OUT", "prefix": "[b] "},
+		{"name": "c", "output": "file", "filename": "$OUT", "prefix": "[c] ", "level": "error"}
+	]}`)
+	defer cleanup()
+	server := httptest.NewServer(AdminHandler(l))
+	defer server.Close()
+
+	// the configured level of c is kept, the level set on b as well
+	putLevel(t, server, "level=DEBUG")
+	l.Debug("one")
+	putLevel(t, server, "level=ERROR&item=b")
+	l.Debug("two")
+	l.Error("three")
+
+	got := read()
+	written := make(map[string]bool)
+	for _, line := range strings.Split(got, "\n") {
+		if i := strings.LastIndex(line, ": "); i > 0 && len(line) > 4 {
+			written[line[:4]+line[i+2:]] = true
+		}
+	}
+	for _, s := range []string{"[a] one", "[b] one", "[a] two", "[a] three", "[b] three", "[c] three"} {
+		if !written[s] {
+			t.Errorf("%q not written:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{"[c] one", "[b] two", "[c] two"} {
+		if written[s] {
+			t.Errorf("%q written:\n%s", s, got)
+		}
+	}
+	if !l.IsDebugEnabled() {
+		t.Error("IsDebugEnabled ignores the item a following the logger")
+	}
+}
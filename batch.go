@@ -0,0 +1,294 @@
+package log4g
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize  = 1000
+	defaultBatchBytes = 1024 * 1024
+	defaultBatchWait  = time.Second
+	defaultQueueSize  = 10000
+	defaultRetries    = 5
+	// how long flush waits for a batch that keeps failing, which is then
+	// sent in the background
+	defaultFlushTimeout = 5 * time.Second
+)
+
+var errQueueFull = errors.New("log4g: item queue full")
+
+// batchEntry is an encoded record waiting to be sent in a batch.
+type batchEntry struct {
+	time time.Time
+	key  string // the group of the record in the batch, such as a loki stream
+	data []byte
+}
+
+// batcher queues the encoded records of a network item and sends them in
+// batches of at most maxSize records or maxBytes bytes, once a batch is full
+// or its first record waited maxWait, and on Flush. Records beyond maxQueue
+// waiting are dropped, so that logging never blocks on the network.
+type batcher struct {
+	item     *GenericLoggerItem
+	send     func(batch []batchEntry) error // may retry while waiting with wait
+	maxSize  int
+	maxBytes int
+	maxWait  time.Duration
+	maxQueue int
+	retries  int
+	flushMax time.Duration // how long flush waits
+	mu       sync.Mutex    // protects the following fields
+	queue    []batchEntry
+	size     int  // bytes of the queue
+	sending  bool // a batch taken off the queue is being sent
+	flushing int  // callers of flush waiting for the queue to empty
+	idle     *sync.Cond
+	started  bool
+	closed   bool
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newBatcher returns the batcher configured by lc for item, sending the
+// batches with send.
+func newBatcher(lc *loggerConfig, item *GenericLoggerItem, send func(batch []batchEntry) error) *batcher {
+	b := &batcher{
+		item:     item,
+		send:     send,
+		maxSize:  lc.BatchSize,
+		maxBytes: lc.BatchBytes,
+		maxWait:  configDuration("batch_wait", lc.BatchWait, defaultBatchWait),
+		maxQueue: lc.QueueSize,
+		retries:  lc.Retries,
+		flushMax: defaultFlushTimeout,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if b.maxSize <= 0 {
+		b.maxSize = defaultBatchSize
+	}
+	if b.maxBytes <= 0 {
+		b.maxBytes = defaultBatchBytes
+	}
+	if b.maxQueue <= 0 {
+		b.maxQueue = defaultQueueSize
+	}
+	if b.retries == 0 {
+		b.retries = defaultRetries
+	}
+	b.idle = sync.NewCond(&b.mu)
+	return b
+}
+
+// start starts the sender. The item calls it once it has its metrics.
+func (b *batcher) start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.started && !b.closed {
+		b.started = true
+		go b.run()
+	}
+}
+
+// add queues e, or returns errQueueFull if too many records wait.
+func (b *batcher) add(e batchEntry) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, errItemStopped
+	}
+	if len(b.queue) >= b.maxQueue {
+		return 0, errQueueFull
+	}
+	b.queue = append(b.queue, e)
+	b.size += len(e.data)
+	b.item.metrics.queued(1)
+	if len(b.queue) >= b.maxSize || b.size >= b.maxBytes {
+		b.signal()
+	}
+	return len(e.data), nil
+}
+
+func (b *batcher) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush sends the queued records and waits until they are sent or dropped,
+// or for flushMax at most while send retries.
+func (b *batcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.started {
+		return
+	}
+	b.flushing++
+	b.signal()
+	deadline := time.Now().Add(b.flushMax)
+	t := time.AfterFunc(b.flushMax, func() {
+		b.mu.Lock()
+		b.idle.Broadcast()
+		b.mu.Unlock()
+	})
+	for (len(b.queue) > 0 || b.sending) && !b.closed && time.Now().Before(deadline) {
+		b.idle.Wait()
+	}
+	t.Stop()
+	b.flushing--
+}
+
+// close sends the queued records and stops the sender. The retries of send
+// are cut short, and the records not sent then are dropped.
+func (b *batcher) close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	started := b.started
+	b.mu.Unlock()
+	if started {
+		close(b.stop)
+		<-b.done
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := len(b.queue); n > 0 {
+		b.item.metrics.droppedBatch(n)
+		b.item.metrics.queued(-n)
+		b.queue = nil
+		b.size = 0
+	}
+	b.idle.Broadcast()
+}
+
+// wait sleeps for d, and reports false if the batcher is closed meanwhile.
+func (b *batcher) wait(d time.Duration) bool {
+	select {
+	case <-b.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// retryHint is implemented by the errors telling retry when to try again:
+// after d, after the usual delay if d is 0, or never if d is negative.
+type retryHint interface {
+	retryAfter() (d time.Duration)
+}
+
+// retry calls send until it succeeds, at most retries more times, waiting
+// a growing delay, or the delay the error asks for up to maxRetry, between
+// the attempts. It gives up once the batcher is closed.
+func (b *batcher) retry(send func() error) error {
+	backoff := minRetry
+	for i := 0; ; i++ {
+		err := send()
+		if err == nil || i >= b.retries {
+			return err
+		}
+		delay := jitter(backoff)
+		if h, ok := err.(retryHint); ok {
+			if d := h.retryAfter(); d < 0 {
+				return err
+			} else if d > maxRetry {
+				delay = maxRetry
+			} else if d > 0 {
+				delay = d
+			}
+		}
+		if !b.wait(delay) {
+			return err
+		}
+		if err != errItemStopped {
+			b.item.health.fail(err)
+		}
+		if backoff *= 2; backoff > maxRetry {
+			backoff = maxRetry
+		}
+	}
+}
+
+// run sends the batches that are due until the batcher is closed, then the
+// records left.
+func (b *batcher) run() {
+	defer close(b.done)
+	for {
+		batch, due := b.next(false)
+		if batch != nil {
+			b.deliver(batch)
+			continue
+		}
+		var timer <-chan time.Time
+		if due > 0 {
+			timer = time.After(due)
+		}
+		select {
+		case <-b.stop:
+			// once a batch fails the others would wait as long, so close
+			// drops them
+			for batch, _ := b.next(true); batch != nil; batch, _ = b.next(true) {
+				if !b.deliver(batch) {
+					break
+				}
+			}
+			return
+		case <-b.wake:
+		case <-timer:
+		}
+	}
+}
+
+// next takes the next batch off the queue if it is due, or if all is. If
+// none is due, it returns how long until the first record is, or 0 if the
+// queue is empty.
+func (b *batcher) next(all bool) ([]batchEntry, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) == 0 {
+		b.idle.Broadcast()
+		return nil, 0
+	}
+	age := time.Since(b.queue[0].time)
+	if !all && b.flushing == 0 && age < b.maxWait && len(b.queue) < b.maxSize && b.size < b.maxBytes {
+		return nil, b.maxWait - age
+	}
+	n, size := 0, 0
+	for n < len(b.queue) && n < b.maxSize && (n == 0 || size+len(b.queue[n].data) <= b.maxBytes) {
+		size += len(b.queue[n].data)
+		n++
+	}
+	batch := b.queue[:n:n]
+	b.queue = b.queue[n:]
+	b.size -= size
+	b.sending = true
+	return batch, 0
+}
+
+// deliver sends batch, dropping its records if that fails, and reports
+// whether it was sent.
+func (b *batcher) deliver(batch []batchEntry) bool {
+	err := b.send(batch)
+	b.item.metrics.queued(-len(batch))
+	if err != nil {
+		b.item.metrics.droppedBatch(len(batch))
+		if err != errItemStopped {
+			b.item.health.fail(err)
+		}
+	}
+	b.mu.Lock()
+	b.sending = false
+	if len(b.queue) == 0 {
+		b.idle.Broadcast()
+	}
+	b.mu.Unlock()
+	return err == nil
+}
@@ -0,0 +1,43 @@
+package log4g
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchFlushDeadline(t *testing.T) {
+	var attempts int32
+	var b *batcher
+	b = newBatcher(&loggerConfig{Retries: 2}, &GenericLoggerItem{metrics: &itemMetrics{}}, func(batch []batchEntry) error {
+		return b.retry(func() error {
+			if atomic.AddInt32(&attempts, 1) < 3 {
+				return errors.New("down")
+			}
+			return nil
+		})
+	})
+	b.flushMax = 100 * time.Millisecond
+	b.start()
+	defer b.close()
+	b.add(batchEntry{time: time.Now(), data: []byte("a")})
+
+	// flush gives up on the retries, which go on
+	start := time.Now()
+	b.flush()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("flush waited %v", d)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&attempts) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d attempts, want 3", atomic.LoadInt32(&attempts))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.flush()
+	if n := atomic.LoadInt64(&b.item.metrics.drops); n != 0 {
+		t.Errorf("%d records dropped", n)
+	}
+}
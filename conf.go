@@ -2,18 +2,29 @@ package log4g
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
+const envVarPrefix = "LOG4G_"
+
 var (
-	gEnv                  string
+	gEnv                  = envOverride("")
+	gSetEnv               string
 	gFile                 string
 	defaultConfigFilepath = []string{"log4g.json", "conf/log4g.json", "config/log4g.json"}
 )
 
 type loggerConfig struct {
+	Name      string `json:"name"`
+	Ref       string `json:"ref"`
 	Disabled  bool   `json:"disabled"`
 	Prefix    string `json:"prefix"`
 	Level     string `json:"level"`
@@ -27,13 +38,95 @@ type loggerConfig struct {
 	Daily     bool   `json:"daily"`
 	Address   string `json:"address"`
 	DB        int    `json:"db"`
-	Password  string `json:"password"`
+	Password  string `json:"password" secret:"true"`
 	RedisType string `json:"redis_type"`
 	RedisKey  string `json:"redis_key"`
 	Network   string `json:"network"`
 	Codec     string `json:"codec"`
 	JsonKey   string `json:"json_key"`
 	JsonExt   string `json:"json_ext"`
+
+	// the directory network items spool to while delivery fails, limited to
+	// SpoolMaxSize MB and records younger than SpoolMaxAge
+	Spool        string `json:"spool,omitempty"`
+	SpoolMaxSize int64  `json:"spool_max_size,omitempty"`
+	SpoolMaxAge  string `json:"spool_max_age,omitempty"`
+
+	// the addresses of a socket item, balanced by "failover" (the default)
+	// or "round_robin", and its timeouts; host names are resolved again every
+	// Resolve (default 1m)
+	Addresses    []string `json:"addresses,omitempty"`
+	Balance      string   `json:"balance,omitempty"`
+	DialTimeout  string   `json:"dial_timeout,omitempty"`
+	WriteTimeout string   `json:"write_timeout,omitempty"`
+	Resolve      string   `json:"resolve,omitempty"`
+
+	// the CA bundle, client certificate and key, server name and minimum
+	// version ("1.2" by default) of a socket item on the "tls" network
+	TLSCA         string `json:"tls_ca,omitempty"`
+	TLSCert       string `json:"tls_cert,omitempty"`
+	TLSKey        string `json:"tls_key,omitempty"`
+	TLSServerName string `json:"tls_server_name,omitempty"`
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+
+	// the header of the messages of a syslog item, in the "rfc5424" (the
+	// default) or "rfc3164" format, the SD-ID of the structured data made of
+	// the fields, and the syslog severities of some levels
+	SyslogFormat string            `json:"syslog_format,omitempty"`
+	Facility     string            `json:"facility,omitempty"`
+	AppName      string            `json:"app_name,omitempty"`
+	ProcID       string            `json:"proc_id,omitempty"`
+	MsgID        string            `json:"msg_id,omitempty"`
+	SDID         string            `json:"sd_id,omitempty"`
+	Severities   map[string]string `json:"severities,omitempty"`
+
+	// the compression ("gzip", "zlib" or none) of the messages of a gelf
+	// item on udp, and the size of their chunks (default 1420)
+	Compression string `json:"compression,omitempty"`
+	ChunkSize   int    `json:"chunk_size,omitempty"`
+
+	// the batches of fluent and other batching items: at most BatchSize
+	// records (default 1000) or BatchBytes bytes (default 1MB), sent once full
+	// or BatchWait (default 1s) after their first record; new records are
+	// dropped while QueueSize (default 10000) wait; a batch that fails is
+	// sent again up to Retries (default 5, none if negative) times
+	BatchSize  int    `json:"batch_size,omitempty"`
+	BatchBytes int    `json:"batch_bytes,omitempty"`
+	BatchWait  string `json:"batch_wait,omitempty"`
+	QueueSize  int    `json:"queue_size,omitempty"`
+	Retries    int    `json:"retries,omitempty"`
+
+	// the tag of the events of a fluent item, and whether it waits for the
+	// server to acknowledge each batch
+	Tag string `json:"tag,omitempty"`
+	Ack bool   `json:"ack,omitempty"`
+
+	// the url of the loki and other http items, with the headers, basic
+	// (Username and Password) or bearer (Token) authentication and gzip
+	// compression of their requests, which time out after Timeout (default
+	// 10s)
+	URL      string            `json:"url,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Username string            `json:"username,omitempty"`
+	Token    string            `json:"token,omitempty" secret:"true"`
+	Gzip     bool              `json:"gzip,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+
+	// the static labels of the streams of a loki item, the fields, or
+	// "level", that become labels as well, and the "json" (the default) or
+	// "protobuf" format of its requests
+	Labels      map[string]string `json:"labels,omitempty"`
+	LabelFields []string          `json:"label_fields,omitempty"`
+	LokiFormat  string            `json:"loki_format,omitempty"`
+
+	// the resource attributes of the records of an otlp item, service.name
+	// and host.name defaulting to the executable and host names
+	Resource map[string]string `json:"resource,omitempty"`
+
+	// the children of a failover item, in order of preference
+	Items    []*loggerConfig `json:"items,omitempty"`
+	Failures int             `json:"failures,omitempty"`
+	Cooldown string          `json:"cooldown,omitempty"`
 }
 
 func NewConfig() *Config {
@@ -43,10 +136,29 @@ func NewConfig() *Config {
 }
 
 type Config struct {
-	Prefix string          `json:"prefix"`
-	Level  string          `json:"level"`
-	Flag   string          `json:"flag"`
-	Items  []*loggerConfig `json:"items"`
+	Prefix  string             `json:"prefix"`
+	Level   string             `json:"level"`
+	Flag    string             `json:"flag"`
+	Vmodule string             `json:"vmodule,omitempty"`
+	Levels  []*levelConfig     `json:"levels,omitempty"`
+	Items   []*loggerConfig    `json:"items"`
+	Loggers map[string]*Config `json:"loggers,omitempty"`
+	Control *controlConfig     `json:"control,omitempty"`
+
+	// a config fetched from ConfigURL every ConfigPoll (default 1m) is
+	// layered on top of the files; the last good one is kept in ConfigCache
+	ConfigURL   string `json:"config_url,omitempty"`
+	ConfigPoll  string `json:"config_poll,omitempty"`
+	ConfigCache string `json:"config_cache,omitempty"`
+}
+
+// levelConfig declares a custom level. Color applies to the level name on
+// stdout and stderr.
+type levelConfig struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+	Color string `json:"color,omitempty"`
+	Alias string `json:"alias,omitempty"`
 }
 
 func (c *Config) initDefault()  {
@@ -55,28 +167,536 @@ func (c *Config) initDefault()  {
 	c.Flag = "date|time|shortfile"
 }
 
+// envOverride applies the profile precedence: the -log4g.env flag wins over
+// the LOG4G_ENV variable, which wins over the env passed to SetEnv.
+func envOverride(env string) string {
+	if e := override(gArgs.env, "env"); e != "" {
+		return e
+	}
+	return env
+}
+
 func setEnv(env string) {
-	gEnv = env
-	//loadDefaultConfig()
+	gSetEnv = env
+	gEnv = envOverride(env)
+	reloadAll()
+}
+
+// configFilepath returns the config files of the default logger: those given
+// by -log4g.config or LOG4G_CONFIG, comma separated, else the default ones.
+func configFilepath() []string {
+	if files := override(gArgs.config, "config"); files != "" {
+		return strings.Split(files, ",")
+	}
+	return defaultConfigFilepath
+}
+
+// applyOverrides applies -log4g.flag, -log4g.vmodule and -log4g.output, or
+// their LOG4G_* variables, to a loaded config. The outputs, comma separated, replace the
+// configured items: "stdout" and "stderr" write to the console, anything
+// else is a file name. Logger sections write to the same outputs.
+func applyOverrides(config *Config) {
+	if flag := override(gArgs.flag, "flag"); flag != "" {
+		config.Flag = flag
+	}
+	if vmodule := override(gArgs.vmodule, "vmodule"); vmodule != "" {
+		config.Vmodule = vmodule
+	}
+	outputs := override(gArgs.output, "output")
+	if outputs == "" {
+		return
+	}
+	config.Items = nil
+	var refs []*loggerConfig
+	for _, output := range strings.Split(outputs, ",") {
+		lc := &loggerConfig{Name: output, Output: output}
+		if output != "stdout" && output != "stderr" {
+			lc.Output = "file"
+			lc.Filename = output
+		}
+		config.Items = append(config.Items, lc)
+		refs = append(refs, &loggerConfig{Ref: output})
+	}
+	for _, sc := range config.Loggers {
+		if sc != nil {
+			sc.Items = refs
+		}
+	}
+}
+
+// profileFilepath returns the profile variant of a config file,
+// e.g. log4g.json becomes log4g-prod.json for the env "prod".
+func profileFilepath(filename, env string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-" + env + ext
+}
+
+// section returns the config of the named logger, or nil if the config does
+// not declare it. Unset prefix, level and flag are taken from c.
+func (c *Config) section(name string) *Config {
+	sc, ok := c.Loggers[name]
+	if !ok || sc == nil {
+		return nil
+	}
+	r := *sc
+	if r.Prefix == "" {
+		r.Prefix = c.Prefix
+	}
+	if r.Level == "" {
+		r.Level = c.Level
+	}
+	if r.Flag == "" {
+		r.Flag = c.Flag
+	}
+	if r.Vmodule == "" {
+		r.Vmodule = c.Vmodule
+	}
+	return &r
+}
+
+// allItems returns the items of c and of its logger sections, with the
+// children of failover items.
+func (c *Config) allItems() []*loggerConfig {
+	items := withChildren(nil, c.Items)
+	for _, sc := range c.Loggers {
+		if sc != nil {
+			items = withChildren(items, sc.Items)
+		}
+	}
+	return items
+}
+
+func withChildren(items, lcs []*loggerConfig) []*loggerConfig {
+	for _, lc := range lcs {
+		items = append(items, lc)
+		items = withChildren(items, lc.Items)
+	}
+	return items
+}
+
+// configLayer is the raw form of a config file. Items are kept raw so they
+// can be decoded on top of the inherited item of the same name, and logger
+// sections so they merge the same way as the top level. Levels add to the
+// inherited ones.
+type configLayer struct {
+	*Config
+	Levels  []*levelConfig             `json:"levels"`
+	Items   []json.RawMessage          `json:"items"`
+	Loggers map[string]json.RawMessage `json:"loggers"`
+}
+
+// readConfigFile merges filename, and the files it extends, onto config.
+// seen guards against extends and include cycles.
+func readConfigFile(filename string, config *Config, seen map[string]bool) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if seen[abs] {
+		return fmt.Errorf("log4g: config %s extends or includes itself", filename)
+	}
+	seen[abs] = true
+	defer delete(seen, abs)
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return mergeConfigData(data, filepath.Dir(filename), config, seen)
+}
+
+// mergeConfigData merges a config document onto config. The files listed in
+// "extends" are merged first, in order, relative to dir. Then the values
+// present in the document override the inherited ones: prefix, level and
+// flag are replaced, an item whose name matches an inherited item is decoded
+// on top of a copy of it, and any other item is appended. Logger sections
+// merge into the inherited section of the same name by the same rules.
+// Last, the files listed in "include" are merged on top of the document.
+func mergeConfigData(data []byte, dir string, config *Config, seen map[string]bool) error {
+	var head struct {
+		Extends []string `json:"extends"`
+		Include []string `json:"include"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	if err := readConfigFiles(head.Extends, dir, config, seen); err != nil {
+		return err
+	}
+	if err := mergeLayer(data, config); err != nil {
+		return err
+	}
+	return readConfigFiles(head.Include, dir, config, seen)
+}
+
+// readConfigFiles merges filenames, relative to dir, onto config in order.
+func readConfigFiles(filenames []string, dir string, config *Config, seen map[string]bool) error {
+	for _, filename := range filenames {
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		if err := readConfigFile(filename, config, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mergeLayer(data []byte, config *Config) error {
+	layer := configLayer{Config: config}
+	if err := json.Unmarshal(data, &layer); err != nil {
+		return err
+	}
+	config.Levels = append(config.Levels, layer.Levels...)
+	for name, raw := range layer.Loggers {
+		sc := config.Loggers[name]
+		if sc == nil {
+			sc = new(Config)
+		}
+		if err := mergeLayer(raw, sc); err != nil {
+			return err
+		}
+		if config.Loggers == nil {
+			config.Loggers = make(map[string]*Config)
+		}
+		config.Loggers[name] = sc
+	}
+	for _, raw := range layer.Items {
+		var key struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return err
+		}
+		lc := new(loggerConfig)
+		i := config.itemIndex(key.Name)
+		if i >= 0 {
+			lc = config.Items[i].clone()
+		}
+		if err := json.Unmarshal(raw, lc); err != nil {
+			return err
+		}
+		if i >= 0 {
+			config.Items[i] = lc
+		} else {
+			config.Items = append(config.Items, lc)
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy of lc, so decoding on top of the copy leaves lc
+// and the configs sharing it as they were.
+func (lc *loggerConfig) clone() *loggerConfig {
+	c := *lc
+	c.Addresses = append([]string(nil), lc.Addresses...)
+	c.LabelFields = append([]string(nil), lc.LabelFields...)
+	c.Severities = cloneStrings(lc.Severities)
+	c.Headers = cloneStrings(lc.Headers)
+	c.Labels = cloneStrings(lc.Labels)
+	c.Resource = cloneStrings(lc.Resource)
+	if lc.Items != nil {
+		c.Items = make([]*loggerConfig, len(lc.Items))
+		for i, child := range lc.Items {
+			c.Items[i] = child.clone()
+		}
+	}
+	return &c
+}
+
+func cloneStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// itemIndex returns the index of the item named name, or -1.
+func (c *Config) itemIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, lc := range c.Items {
+		if lc.Name == name {
+			return i
+		}
+	}
+	return -1
 }
 
 func loadConfig(filepath string, mapping interface{}) error {
 
-	config := mapping.(*Config)
+	// the layers are merged into a scratch config, which replaces the mapped
+	// one only once it is valid, so a bad file leaves no trace behind
+	config := NewConfig()
 
 	// load form Config file
 	_, err := os.Stat(filepath)
-	if err == nil { //file exist
-		data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+	err = readConfigFile(filepath, config, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	// layer the profile file on top of the base one
+	if gEnv != "" {
+		profile := profileFilepath(filepath, gEnv)
+		if _, err := os.Stat(profile); err == nil {
+			if err := readConfigFile(profile, config, map[string]bool{}); err != nil {
+				return err
+			}
+		}
+	}
+	// and the remote config on top of both
+	if config.ConfigURL != "" {
+		for _, data := range remoteFor(config).load() {
+			if err := mergeLayer(data, config); err != nil {
+				return err
+			}
+		}
+	}
+	expandConfig(config)
+	applyOverrides(config)
+	err = resolveSecrets(config)
+	if err != nil {
+		return err
+	}
+	err = checkLevels(config)
+	if err != nil {
+		return err
+	}
+	_, err = parseVmodule(config.Vmodule)
+	if err != nil {
+		return err
+	}
+	err = registerLevels(config.Levels)
+	if err != nil {
+		return err
+	}
+	*mapping.(*Config) = *config
+	return nil
+}
+
+// expandConfig expands ${VAR} and ${VAR:-default} in every string field of
+// the config and its items. The built-ins ${hostname}, ${pid}, ${app} and
+// ${env} are resolved before the environment. A literal "${" is written "$${".
+func expandConfig(config *Config) {
+	expandValue(reflect.ValueOf(config))
+}
+
+func expandValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			expandValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				expandValue(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandValue(v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			expandValue(e)
+			v.SetMapIndex(k, e)
+		}
+	case reflect.String:
+		v.SetString(expand(v.String()))
+	}
+}
+
+func expand(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' && i+2 < len(s) && s[i+1] == '$' && s[i+2] == '{' {
+			buf = append(buf, "${"...)
+			i += 2
+			continue
+		}
+		if s[i] == '$' && i+1 < len(s) && s[i+1] == '{' {
+			if end := strings.IndexByte(s[i+2:], '}'); end >= 0 {
+				buf = append(buf, lookupVar(s[i+2:i+2+end])...)
+				i += 2 + end
+				continue
+			}
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
+}
+
+func lookupVar(name string) string {
+	def := ""
+	if i := strings.Index(name, ":-"); i >= 0 {
+		name, def = name[:i], name[i+2:]
+	}
+	var value string
+	switch name {
+	case "hostname":
+		value, _ = os.Hostname()
+	case "pid":
+		value = strconv.Itoa(os.Getpid())
+	case "app":
+		value = appName()
+	case "env":
+		value = gEnv
+	default:
+		value = os.Getenv(name)
+	}
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// appName is the executable name without directory and extension.
+func appName() string {
+	name := filepath.Base(os.Args[0])
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+const redactedSecret = "******"
+
+// secretFields returns the string fields tagged secret:"true" of the struct
+// pointed to by ptr.
+func secretFields(ptr interface{}) []reflect.Value {
+	var fields []reflect.Value
+	v := reflect.ValueOf(ptr).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("secret") == "true" {
+			fields = append(fields, v.Field(i))
+		}
+	}
+	return fields
+}
+
+// resolveSecrets replaces every secret field holding a "file://path" or
+// "env:NAME" reference with the value it refers to. It runs on each load, so
+// a reload picks up rotated secrets.
+func resolveSecrets(config *Config) error {
+	var fields []reflect.Value
+	for _, lc := range config.allItems() {
+		fields = append(fields, secretFields(lc)...)
+	}
+	if config.Control != nil {
+		fields = append(fields, secretFields(config.Control)...)
+	}
+	for _, f := range fields {
+		s, err := resolveSecret(f.String())
 		if err != nil {
 			return err
 		}
-		err = json.Unmarshal(data, config)
+		f.SetString(s)
+	}
+	return nil
+}
+
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "file://"):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file://"))
 		if err != nil {
-			return err
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("log4g: secret variable %s is not set", name)
+		}
+		return value, nil
+	}
+	return ref, nil
+}
+
+// redacted returns a copy of lc with the secret fields masked, and the
+// values of the headers, which often carry credentials.
+func (lc *loggerConfig) redacted() *loggerConfig {
+	c := *lc
+	redact(&c)
+	if lc.Headers != nil {
+		c.Headers = make(map[string]string, len(lc.Headers))
+		for k := range lc.Headers {
+			c.Headers[k] = redactedSecret
 		}
 	}
-	return err
+	if lc.Items != nil {
+		c.Items = make([]*loggerConfig, len(lc.Items))
+		for i, child := range lc.Items {
+			c.Items[i] = child.redacted()
+		}
+	}
+	return &c
+}
+
+// redact masks the non-empty secret fields of the struct pointed to by ptr.
+func redact(ptr interface{}) {
+	for _, f := range secretFields(ptr) {
+		if f.String() != "" {
+			f.SetString(redactedSecret)
+		}
+	}
+}
+
+func (lc *loggerConfig) String() string {
+	return JsonString(lc.redacted())
+}
+
+// redacted returns a copy of c whose items have their secret fields masked.
+func (c *Config) redacted() *Config {
+	r := *c
+	r.Items = make([]*loggerConfig, len(c.Items))
+	for i, lc := range c.Items {
+		r.Items[i] = lc.redacted()
+	}
+	if c.Control != nil {
+		control := *c.Control
+		redact(&control)
+		r.Control = &control
+	}
+	if c.Loggers != nil {
+		r.Loggers = make(map[string]*Config, len(c.Loggers))
+		for name, sc := range c.Loggers {
+			if sc != nil {
+				r.Loggers[name] = sc.redacted()
+			}
+		}
+	}
+	return &r
+}
+
+func (c *Config) String() string {
+	return JsonString(c.redacted())
+}
+
+// configDuration parses the value s of the duration key name of an item, or
+// returns def if s is empty or invalid.
+func configDuration(name, s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("log4g: invalid %s %s", name, s)
+		return def
+	}
+	return d
 }
 
 func parseFlag(strFlag string) int {
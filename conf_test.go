@@ -0,0 +1,250 @@
+package log4g
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func writeConfigs(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// itemLogger returns a logger of the item described by the JSON object item,
+// with the top level members top, such as `"flag": ""`. The errors of the
+// item are ignored, and its config is removed once the test ends.
+func itemLogger(t *testing.T, top, item string) *Logger {
+	if top != "" {
+		top += ", "
+	}
+	dir := writeConfigs(t, map[string]string{"log4g.json": "{" + top + `"items": [` + item + "]}"})
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	l := NewLogger(filepath.Join(dir, "log4g.json"))
+	l.SetErrorHandler(func(item string, err error) {})
+	return l
+}
+
+func TestExtendsAndInclude(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"base/log4g.json": `{"level": "info", "prefix": "[base] ", "items": [
+			{"name": "file", "output": "file", "filename": "base.log"},
+			{"name": "http", "output": "http", "url": "http://a", "headers": {"X-Team": "core"}}
+		]}`,
+		"items/http.json": `{"items": [{"name": "http", "headers": {"X-Env": "prod"}}]}`,
+		"log4g.json": `{
+			"extends": ["base/log4g.json"],
+			"include": ["items/http.json"],
+			"prefix": "[orders] ",
+			"items": [{"name": "file", "filename": "orders.log"}, {"name": "http", "level": "warn"}]
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	config := NewConfig()
+	if err := readConfigFile(filepath.Join(dir, "log4g.json"), config, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if config.Level != "info" || config.Prefix != "[orders] " {
+		t.Errorf("level %s, prefix %q", config.Level, config.Prefix)
+	}
+	if len(config.Items) != 2 {
+		t.Fatalf("%d items", len(config.Items))
+	}
+	if file := config.Items[0]; file.Output != "file" || file.Filename != "orders.log" {
+		t.Errorf("file item %+v", file)
+	}
+	http := config.Items[1]
+	if http.URL != "http://a" || http.Level != "warn" || http.Headers["X-Team"] != "core" || http.Headers["X-Env"] != "prod" {
+		t.Errorf("http item %+v", http)
+	}
+}
+
+func TestItemOverrideCopiesMaps(t *testing.T) {
+	config := NewConfig()
+	if err := mergeConfigData([]byte(`{"items": [{"name": "loki", "labels": {"job": "a"}, "label_fields": ["level"]}]}`), ".", config, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	base := config.Items[0]
+	if err := mergeConfigData([]byte(`{"items": [{"name": "loki", "labels": {"job": "b"}, "label_fields": ["region"]}]}`), ".", config, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if base.Labels["job"] != "a" || base.LabelFields[0] != "level" {
+		t.Errorf("inherited item changed: %v %v", base.Labels, base.LabelFields)
+	}
+	if lc := config.Items[0]; lc.Labels["job"] != "b" || lc.LabelFields[0] != "region" {
+		t.Errorf("override not applied: %v %v", lc.Labels, lc.LabelFields)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"a.json": `{"include": ["b.json"]}`,
+		"b.json": `{"include": ["a.json"]}`,
+	})
+	defer os.RemoveAll(dir)
+	if err := readConfigFile(filepath.Join(dir, "a.json"), NewConfig(), map[string]bool{}); err == nil {
+		t.Error("no error on an include cycle")
+	}
+}
+
+func TestRedactedHeaders(t *testing.T) {
+	config := NewConfig()
+	err := mergeConfigData([]byte(`{"items": [{"name": "loki", "output": "loki", "token": "t0ken",
+		"headers": {"Authorization": "Basic c2VjcmV0", "X-Scope-OrgID": "tenant1"}}]}`), ".", config, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := config.String()
+	for _, secret := range []string{"t0ken", "c2VjcmV0", "tenant1"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("%s in the dump:\n%s", secret, dump)
+		}
+	}
+	if !strings.Contains(dump, "Authorization") {
+		t.Errorf("header names missing from the dump:\n%s", dump)
+	}
+	if config.Items[0].Headers["Authorization"] != "Basic c2VjcmV0" {
+		t.Errorf("config headers changed: %v", config.Items[0].Headers)
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	remote := "http://127.0.0.1:1/layers.json"
+	dir := writeConfigs(t, map[string]string{
+		"log4g.json": `{"prefix": "[base] ", "vmodule": "db=2", "level": "debug", "flag": "date",
+			"config_url": "` + remote + `", "config_cache": "${CACHE}"}`,
+		"log4g-prod.json": `{"prefix": "[prod] ", "level": "info", "flag": "time"}`,
+		"remote.json":     `[{"level": "warn", "flag": "longfile"}]`,
+	})
+	defer os.RemoveAll(dir)
+	os.Setenv("CACHE", filepath.Join(dir, "remote.json"))
+	os.Setenv("LOG4G_FLAG", "shortfile")
+	defer os.Unsetenv("CACHE")
+	defer os.Unsetenv("LOG4G_FLAG")
+	defer func(env string) { gEnv = env }(gEnv)
+	defer func() {
+		remotesMu.Lock()
+		delete(remotes, remote)
+		remotesMu.Unlock()
+	}()
+
+	// base < profile < remote < overrides
+	gEnv = "prod"
+	config := NewConfig()
+	if err := loadConfig(filepath.Join(dir, "log4g.json"), config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Vmodule != "db=2" || config.Prefix != "[prod] " || config.Level != "warn" || config.Flag != "shortfile" {
+		t.Errorf("vmodule %q, prefix %q, level %q, flag %q", config.Vmodule, config.Prefix, config.Level, config.Flag)
+	}
+
+	// without the profile, the remote config layers on the base one
+	gEnv = ""
+	config = NewConfig()
+	if err := loadConfig(filepath.Join(dir, "log4g.json"), config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Prefix != "[base] " || config.Level != "warn" {
+		t.Errorf("prefix %q, level %q", config.Prefix, config.Level)
+	}
+}
+
+func TestSetEnvReloads(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"prefix": "[base] ", "items": [{"output": "file", "filename": "$OUT"}]}`)
+	defer cleanup()
+	profile := profileFilepath(l.filepath[0], "staging")
+	if err := ioutil.WriteFile(profile, []byte(`{"prefix": "[staging] "}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer SetEnv(GetEnv())
+	l.Info("before")
+	SetEnv("staging")
+	l.Info("after")
+	got := read()
+	if !hasLine(got, "[base] ", "before") || !hasLine(got, "[staging] ", "after") {
+		t.Errorf("file holds:\n%s", got)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	os.Setenv("LOG4G_TEST_DIR", "/var/log")
+	os.Unsetenv("LOG4G_TEST_UNSET")
+	defer os.Unsetenv("LOG4G_TEST_DIR")
+	defer func(env string) { gEnv = env }(gEnv)
+	gEnv = "prod"
+	hostname, _ := os.Hostname()
+	for s, want := range map[string]string{
+		"plain":                              "plain",
+		"${LOG4G_TEST_DIR}/app.log":          "/var/log/app.log",
+		"${LOG4G_TEST_DIR:-/tmp}/app.log":    "/var/log/app.log",
+		"${LOG4G_TEST_UNSET:-/tmp}/app.log":  "/tmp/app.log",
+		"${LOG4G_TEST_UNSET}/app.log":        "/app.log",
+		"${hostname}-${pid}":                 hostname + "-" + strconv.Itoa(os.Getpid()),
+		"${app}.log":                         appName() + ".log",
+		"log4g-${env}":                       "log4g-prod",
+		"$${LOG4G_TEST_DIR}":                 "${LOG4G_TEST_DIR}",
+		"cost: $5 ${LOG4G_TEST_DIR}":         "cost: $5 /var/log",
+		"${LOG4G_TEST_DIR":                   "${LOG4G_TEST_DIR",
+		"${LOG4G_TEST_DIR}/${LOG4G_TEST_DIR": "/var/log/${LOG4G_TEST_DIR",
+	} {
+		if got := expand(s); got != want {
+			t.Errorf("expand(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{"password": "s3cret\n"})
+	defer os.RemoveAll(dir)
+	os.Setenv("LOG4G_TEST_TOKEN", "t0ken")
+	defer os.Unsetenv("LOG4G_TEST_TOKEN")
+	l := itemLogger(t, "", `{"output": "http", "url": "http://127.0.0.1:1", "username": "app",
+		"password": "file://`+filepath.ToSlash(filepath.Join(dir, "password"))+`", "token": "env:LOG4G_TEST_TOKEN"}`)
+	defer l.Close()
+
+	// the references are resolved, without the trailing newline of the file
+	if lc := l.config.Items[0]; lc.Password != "s3cret" || lc.Token != "t0ken" {
+		t.Errorf("password %q and token %q", lc.Password, lc.Token)
+	}
+	server := httptest.NewServer(AdminHandler(l))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	for name, dump := range map[string]string{"String": l.String(), "admin": string(body)} {
+		if strings.Contains(dump, "s3cret") || strings.Contains(dump, "t0ken") || strings.Count(dump, redactedSecret) != 2 {
+			t.Errorf("%s shows:\n%s", name, dump)
+		}
+	}
+
+	if _, err := resolveSecret("env:LOG4G_TEST_UNSET"); err == nil {
+		t.Error("no error for an unset secret variable")
+	}
+	config := NewConfig()
+	err = mergeConfigData([]byte(`{"items": [{"output": "http", "url": "http://a", "token": "env:LOG4G_TEST_UNSET"}]}`), ".", config, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveSecrets(config); err == nil {
+		t.Error("config loaded with an unset secret variable")
+	}
+}
@@ -0,0 +1,143 @@
+package log4g
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// controlConfig subscribes a logger to level changes published on a redis
+// channel, after applying those stored at key, if any.
+type controlConfig struct {
+	Address  string `json:"address"`
+	Password string `json:"password" secret:"true"`
+	DB       int    `json:"db"`
+	Channel  string `json:"channel"`
+	Key      string `json:"key"`
+}
+
+// controlMessage changes the level of a logger, or of one of its items, for
+// ttl if set. An empty logger is the subscribed one, else one of its named
+// loggers.
+type controlMessage struct {
+	Logger string `json:"logger"`
+	Item   string `json:"item"`
+	Level  *Level `json:"level"`
+	TTL    string `json:"ttl"`
+}
+
+// startControl applies the levels stored at the control key and subscribes
+// to the control channel in the background, so that an unreachable redis
+// does not hold up the config load.
+func (l *Logger) startControl() {
+	l.rw.RLock()
+	cc := l.config.Control
+	l.rw.RUnlock()
+	if cc == nil || cc.Address == "" || (cc.Channel == "" && cc.Key == "") {
+		return
+	}
+	cli := redis.NewClient(&redis.Options{
+		Addr:     cc.Address,
+		Password: cc.Password,
+		DB:       cc.DB,
+	})
+	stop := make(chan struct{})
+	l.mu.Lock()
+	l.control = stop
+	l.mu.Unlock()
+	go l.runControl(cli, cc, stop)
+}
+
+// runControl follows the control of cc until stop is closed.
+func (l *Logger) runControl(cli *redis.Client, cc *controlConfig, stop chan struct{}) {
+	defer cli.Close()
+	if cc.Key != "" {
+		data, err := cli.Get(cc.Key).Bytes()
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err == nil {
+			l.applyControl(data)
+		} else if err != redis.Nil {
+			l.Warn("log4g: failed to read the control key %s: %v", cc.Key, err)
+		}
+	}
+	if cc.Channel == "" {
+		return
+	}
+	pubsub := cli.Subscribe(cc.Channel)
+	defer pubsub.Close()
+	msgs := pubsub.Channel()
+	for {
+		select {
+		case <-stop:
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			l.applyControl([]byte(msg.Payload))
+		}
+	}
+}
+
+func (l *Logger) stopControl() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.control != nil {
+		close(l.control)
+		l.control = nil
+	}
+}
+
+// applyControl applies a control message, or a JSON array of them.
+func (l *Logger) applyControl(data []byte) {
+	var msgs []controlMessage
+	var err error
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &msgs)
+	} else {
+		msgs = make([]controlMessage, 1)
+		err = json.Unmarshal(data, &msgs[0])
+	}
+	if err != nil {
+		l.Warn("log4g: invalid control message %s: %v", data, err)
+		return
+	}
+	for _, msg := range msgs {
+		if msg.Level == nil {
+			l.Warn("log4g: control message %s has no level", data)
+			continue
+		}
+		var ttl time.Duration
+		if msg.TTL != "" {
+			if ttl, err = time.ParseDuration(msg.TTL); err != nil {
+				l.Warn("log4g: invalid control message %s: %v", data, err)
+				continue
+			}
+		}
+		if err = l.setLevel(msg.Logger, msg.Item, *msg.Level, ttl); err != nil {
+			l.Warn("log4g: %v", err)
+			continue
+		}
+		l.Warn("log4g: level of %s set to %v by redis control", msg.target(), *msg.Level)
+	}
+}
+
+func (msg controlMessage) target() string {
+	target := "the logger"
+	if msg.Logger != "" {
+		target = "logger " + msg.Logger
+	}
+	if msg.Item != "" {
+		target += " item " + msg.Item
+	}
+	if msg.TTL != "" {
+		target += " for " + msg.TTL
+	}
+	return target
+}
@@ -0,0 +1,185 @@
+package log4g
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis speaks enough RESP for the control plane: GET, SUBSCRIBE and
+// PING, plus publish from the test.
+type fakeRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	kv   map[string]string
+	subs map[string][]net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{ln: ln, kv: map[string]string{}, subs: map[string][]net.Conn{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		cmd, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		switch strings.ToUpper(cmd[0]) {
+		case "GET":
+			if v, ok := r.kv[cmd[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "SUBSCRIBE":
+			for i, ch := range cmd[1:] {
+				r.subs[ch] = append(r.subs[ch], conn)
+				fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(ch), ch, i+1)
+			}
+		case "PING":
+			fmt.Fprint(conn, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+		r.mu.Unlock()
+	}
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	cmd := make([]string, n)
+	for i := range cmd {
+		if _, err = rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		cmd[i] = strings.TrimRight(arg, "\r\n")
+	}
+	return cmd, nil
+}
+
+// publish returns once a subscriber got the message.
+func (r *fakeRedis) publish(t *testing.T, ch, msg string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		conns := r.subs[ch]
+		for _, conn := range conns {
+			fmt.Fprintf(conn, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(ch), ch, len(msg), msg)
+		}
+		r.mu.Unlock()
+		if len(conns) > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no subscriber on", ch)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitLevel(t *testing.T, get func() Level, want Level) {
+	deadline := time.Now().Add(2 * time.Second)
+	for get() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("level is %v, want %v", get(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisControl(t *testing.T) {
+	r := newFakeRedis(t)
+	defer r.ln.Close()
+	r.kv["log4g-levels"] = `[{"level":"WARN"}]`
+
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := fmt.Sprintf(`{
+		"level": "info",
+		"items": [{"name": "out", "output": "stdout"}],
+		"loggers": {"db": {"items": [{"ref": "out"}]}},
+		"control": {"address": "%s", "channel": "log4g", "key": "log4g-levels"}
+	}`, r.ln.Addr())
+	filename := filepath.Join(dir, "log4g.json")
+	if err := ioutil.WriteFile(filename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLogger(filename)
+	defer l.Close()
+	db := l.Named("db")
+	waitLevel(t, l.GetLevel, LEVEL_WARN)
+
+	r.publish(t, "log4g", `{"logger":"db","level":"TRACE","ttl":"100ms"}`)
+	waitLevel(t, db.GetLevel, LEVEL_TRACE)
+	waitLevel(t, db.GetLevel, LEVEL_INFO)
+
+	r.publish(t, "log4g", `{"logger":"db","item":"out","level":"ERROR"}`)
+	waitLevel(t, db.named["out"].GetLevel, LEVEL_ERROR)
+}
+
+func TestRedisControlDoesNotBlockLoad(t *testing.T) {
+	// a redis that accepts connections and never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	l, _, cleanup := newFileLogger(t, fmt.Sprintf(`{
+		"items": [{"output": "file", "filename": "$OUT"}],
+		"control": {"address": "%s", "channel": "log4g", "key": "log4g-levels"}
+	}`, ln.Addr()))
+	defer cleanup()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("NewLogger took %v", d)
+	}
+	l.Info("logging")
+}
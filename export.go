@@ -42,6 +42,18 @@ func Trace(arg interface{}, args ...interface{}) {
 	exportLoggers.Trace(arg, args...)
 }
 
+// Named returns the logger declared in the "loggers" section name of the
+// default config.
+func Named(name string) *Logger {
+	return exportLoggers.Named(name)
+}
+
+// V reports whether verbosity n is enabled at the call site of the default
+// logger, see Logger.V.
+func V(n int) Verbose {
+	return exportLoggers.v(n, 4)
+}
+
 func GetLevel() Level {
 	return exportLoggers.GetLevel()
 }
@@ -93,37 +105,25 @@ func JsonFunc(v interface{}) func() (arg interface{}, args []interface{}) {
 	}
 }
 
-//var (
-//	useEnvMode  bool
-//	useFileMode bool
-//)
-
-//func SetEnv(env string) {
-//	if useFileMode {
-//		panic("can not set env if programmatically load config file")
-//	}
-//	setEnv(env)
-//	useEnvMode = true
-//}
-
-//ensure
-//func LoadConfig(filename string) {
-//	if useEnvMode {
-//		panic("can not programmatically load config file if set env")
-//	}
-//	err := loadConfig(filename)
-//	if err != nil {
-//		panic(err)
-//	}
-//	useEnvMode = true
-//}
-//
-//func ReloadConfig() {
-//	err := reloadConfig()
-//	if err != nil {
-//		panic(err)
-//	}
-//}
+// SetEnv activates a config profile: every logger reloads with
+// log4g-<env>.json layered on top of log4g.json (and likewise for custom
+// config files). The -log4g.env flag and the LOG4G_ENV variable take
+// precedence over the env set here.
+func SetEnv(env string) {
+	setEnv(env)
+}
+
+func GetEnv() string {
+	return gEnv
+}
+
+func LoadConfig(filepath ...string) {
+	exportLoggers.LoadConfig(filepath...)
+}
+
+func ReloadConfig() {
+	exportLoggers.Reload()
+}
 
 func Flush() {
 	exportLoggers.Flush()
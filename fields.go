@@ -0,0 +1,91 @@
+package log4g
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields are key-value pairs attached to a record by passing them as the
+// last argument of a logging call:
+//
+//	log4g.Info("user %s logged in", name, log4g.Fields{"user_id": id})
+//
+// Text outputs append them to the message as key=value; structured outputs
+// such as syslog keep them apart.
+type Fields map[string]interface{}
+
+// splitFields removes the Fields ending arg and args, if any.
+func splitFields(arg interface{}, args []interface{}) (interface{}, []interface{}, Fields) {
+	if n := len(args); n > 0 {
+		if fields, ok := args[n-1].(Fields); ok {
+			return arg, args[:n-1], fields
+		}
+	} else if fields, ok := arg.(Fields); ok {
+		return "", nil, fields
+	}
+	return arg, args, nil
+}
+
+// keys returns the keys of f in order.
+func (f Fields) keys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendText appends f to buf as " key=value" pairs in key order, quoting
+// the values that need it.
+func (f Fields) appendText(buf []byte) []byte {
+	for _, k := range f.keys() {
+		v := fmt.Sprint(f[k])
+		buf = append(buf, ' ')
+		buf = append(buf, k...)
+		buf = append(buf, '=')
+		if v == "" || strings.ContainsAny(v, " =\"\t\r\n") {
+			buf = strconv.AppendQuote(buf, v)
+		} else {
+			buf = append(buf, v...)
+		}
+	}
+	return buf
+}
+
+// record is a record as handed to the writers that format it themselves,
+// with the caller whatever the flag of the item.
+type record struct {
+	time     time.Time
+	level    Level
+	prefix   string
+	flag     int
+	file     string
+	line     int
+	function string
+	message  string
+	fields   Fields
+}
+
+// caller returns the file and line of r as the flag of the item asks for
+// them, or "".
+func (r *record) caller() string {
+	if r.flag&(Lshortfile|Llongfile) == 0 || r.file == "" {
+		return ""
+	}
+	file := r.file
+	if r.flag&Lshortfile != 0 {
+		file = path.Base(file)
+	}
+	return file + ":" + strconv.Itoa(r.line)
+}
+
+// recordWriter is implemented by the writers of structured outputs. Their
+// items pass them the record instead of its text.
+type recordWriter interface {
+	writeRecord(r *record) (n int, err error)
+}
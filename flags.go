@@ -0,0 +1,107 @@
+package log4g
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// cmdArgs holds the -log4g.* flags. Each one takes precedence over its
+// LOG4G_* variable, which takes precedence over the config files.
+type cmdArgs struct {
+	level   string
+	env     string
+	config  string
+	flag    string
+	output  string
+	vmodule string
+}
+
+var gArgs = new(cmdArgs)
+
+// override returns the flag value if set, else the LOG4G_<NAME> variable.
+func override(flagValue string, name string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(envVarPrefix + strings.ToUpper(name))
+}
+
+// argLevel returns the level given by -log4g.level or LOG4G_LEVEL, if any.
+// An unknown level is reported and ignored.
+func argLevel() Level {
+	name := override(gArgs.level, "level")
+	if name == "" {
+		return 0
+	}
+	level, ok := lookupLevel(name)
+	if !ok {
+		log.Printf("log4g: invalid log level %s ignored", name)
+	}
+	return level
+}
+
+// RegisterFlags registers the -log4g.level, -log4g.env, -log4g.config,
+// -log4g.flag, -log4g.output and -log4g.vmodule flags on fs. A flag applies
+// to the loggers as soon as fs parses it. log4g reads no command-line
+// arguments unless they are registered here.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(&argValue{&gArgs.level, checkLevelArg, applyLevelArg}, "log4g.level", "set log4g log level")
+	fs.Var(&argValue{&gArgs.env, nil, applyEnvArg}, "log4g.env", "set log4g config profile")
+	fs.Var(&argValue{&gArgs.config, nil, applyConfigArg}, "log4g.config", "set log4g config files, comma separated")
+	fs.Var(&argValue{&gArgs.flag, nil, reloadAll}, "log4g.flag", "set log4g header flag, e.g. date|time|shortfile")
+	fs.Var(&argValue{&gArgs.output, nil, reloadAll}, "log4g.output", "set log4g outputs, comma separated: stdout, stderr or file names")
+	fs.Var(&argValue{&gArgs.vmodule, nil, reloadAll}, "log4g.vmodule", "set log4g per-file levels, e.g. db/*=TRACE,cache.go=DEBUG")
+}
+
+// argValue is a flag.Value storing the flag in p and applying it on set.
+type argValue struct {
+	p     *string
+	check func(s string) error
+	apply func()
+}
+
+func (v *argValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+func (v *argValue) Set(s string) error {
+	if v.check != nil {
+		if err := v.check(s); err != nil {
+			return err
+		}
+	}
+	*v.p = s
+	v.apply()
+	return nil
+}
+
+func checkLevelArg(s string) error {
+	if _, ok := lookupLevel(s); !ok {
+		return fmt.Errorf("invalid log level %s", s)
+	}
+	return nil
+}
+
+func applyLevelArg() {
+	level := argLevel()
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	for _, l := range loggers {
+		l.setArgLevelAll(level)
+	}
+}
+
+func applyEnvArg() {
+	gEnv = envOverride(gSetEnv)
+	reloadAll()
+}
+
+func applyConfigArg() {
+	exportLoggers.LoadConfig(configFilepath()...)
+}
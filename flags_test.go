@@ -0,0 +1,68 @@
+package log4g
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLevelFlag(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"level": "debug", "items": [{"output": "file", "filename": "$OUT"}]}`)
+	defer cleanup()
+	defer func() {
+		gArgs.level = ""
+		applyLevelArg()
+	}()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"-log4g.level=LOUD"}); err == nil {
+		t.Error("no error on an invalid level")
+	}
+	if err := fs.Parse([]string{"-log4g.level=error"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Warn("hidden")
+	l.Error("shown")
+	got := read()
+	if strings.Contains(got, "hidden") || !strings.Contains(got, "shown") {
+		t.Errorf("-log4g.level=error wrote:\n%s", got)
+	}
+}
+
+func TestOutputVariable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "override.log")
+	os.Setenv("LOG4G_OUTPUT", out)
+	os.Setenv("LOG4G_FLAG", "shortfile")
+	defer os.Unsetenv("LOG4G_OUTPUT")
+	defer os.Unsetenv("LOG4G_FLAG")
+
+	l, _, cleanup := newFileLogger(t, `{"items": [{"output": "stderr"}], "loggers": {"db": {"items": [{"output": "stderr"}]}}}`)
+	defer cleanup()
+	l.Info("from app")
+	l.Named("db").Info("from db")
+	l.Flush()
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("LOG4G_OUTPUT file holds:\n%s", data)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "INFO flags_test.go:") {
+			t.Errorf("LOG4G_FLAG not applied: %q", line)
+		}
+	}
+}
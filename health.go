@@ -0,0 +1,160 @@
+package log4g
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// an item is degraded for this long after an error
+	degradedFor = time.Minute
+	// the first and the longest delay between the attempts to recover a
+	// stopped item
+	minRetry = time.Second
+	maxRetry = time.Minute
+)
+
+// ItemHealth is the state of an item reported by Logger.Health: "healthy",
+// "degraded" after a recent error or "stopped" until it recovers.
+type ItemHealth struct {
+	Item          string    `json:"item"`
+	Status        string    `json:"status"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+	// the children of a failover item
+	Children []ItemHealth `json:"children,omitempty"`
+}
+
+// itemHealth records the errors of an item, hands them to the error handler
+// of its logger and paces the attempts to recover it once stopped.
+type itemHealth struct {
+	item     string
+	logger   *Logger
+	children []*itemHealth
+	stopped  int32      // accessed atomically
+	mu       sync.Mutex // protects the following fields
+	lastErr  error
+	lastTime time.Time
+	retryAt  time.Time
+	backoff  time.Duration
+}
+
+// fail records an error of an item that still works. A nil h logs err.
+func (h *itemHealth) fail(err error) {
+	if h == nil {
+		log.Println(err)
+		return
+	}
+	h.mu.Lock()
+	h.lastErr = err
+	h.lastTime = time.Now()
+	h.mu.Unlock()
+	h.logger.handleError(h.item, err)
+}
+
+// halt records the error that stopped an item.
+func (h *itemHealth) halt(err error) {
+	if h == nil {
+		log.Println(err)
+		return
+	}
+	h.mu.Lock()
+	h.lastErr = err
+	h.lastTime = time.Now()
+	if atomic.LoadInt32(&h.stopped) == 0 {
+		h.backoff = minRetry
+	} else if h.backoff *= 2; h.backoff > maxRetry {
+		h.backoff = maxRetry
+	}
+	h.retryAt = h.lastTime.Add(jitter(h.backoff))
+	atomic.StoreInt32(&h.stopped, 1)
+	h.mu.Unlock()
+	h.logger.handleError(h.item, err)
+}
+
+// due reports whether a stopped item should try to recover now. Only one
+// caller gets true until the attempt is over.
+func (h *itemHealth) due() bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if now.Before(h.retryAt) {
+		return false
+	}
+	h.retryAt = now.Add(jitter(h.backoff))
+	return true
+}
+
+// jitter spreads d by up to a fifth either way, so that the items of many
+// processes do not retry in step.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d - d/5 + time.Duration(rand.Int63n(int64(d)*2/5+1))
+}
+
+func (h *itemHealth) recovered() {
+	if h != nil {
+		atomic.StoreInt32(&h.stopped, 0)
+	}
+}
+
+func (h *itemHealth) report() ItemHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := ItemHealth{Item: h.item, Status: "healthy"}
+	if h.lastErr != nil {
+		r.LastError = h.lastErr.Error()
+		r.LastErrorTime = h.lastTime
+		if time.Since(h.lastTime) < degradedFor {
+			r.Status = "degraded"
+		}
+	}
+	if atomic.LoadInt32(&h.stopped) != 0 {
+		r.Status = "stopped"
+	}
+	for _, c := range h.children {
+		r.Children = append(r.Children, c.report())
+	}
+	return r
+}
+
+// SetErrorHandler sets the function called with the label of the item, as
+// in the metrics, and the error whenever an item of l fails to write,
+// rotate or reconnect. A named logger without a handler uses the one of its
+// parent; without any the error goes to the standard logger. f is called
+// while the item is writing, so it must not log through l.
+func (l *Logger) SetErrorHandler(f func(item string, err error)) {
+	l.onError.Store(errorHandler(f))
+}
+
+type errorHandler func(item string, err error)
+
+func (l *Logger) handleError(item string, err error) {
+	for p := l; p != nil; p = p.parent {
+		if f, _ := p.onError.Load().(errorHandler); f != nil {
+			f(item, err)
+			return
+		}
+	}
+	log.Printf("log4g: %s: %s", item, strings.TrimPrefix(err.Error(), "log4g: "))
+}
+
+// Health reports the state of each item of l.
+func (l *Logger) Health() []ItemHealth {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	health := make([]ItemHealth, 0, len(l.health))
+	for _, h := range l.health {
+		health = append(health, h.report())
+	}
+	return health
+}
@@ -0,0 +1,77 @@
+package log4g
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestItemHealth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a file where the directory of the log should be stops the item
+	blocked := filepath.Join(dir, "blocked")
+	if err := ioutil.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(blocked, "out.log")
+	config := filepath.Join(dir, "log4g.json")
+	err = ioutil.WriteFile(config, []byte(`{"items": [{"name": "file", "output": "file", "filename": "`+filepath.ToSlash(out)+`"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLogger(config)
+	defer l.Close()
+
+	var mu sync.Mutex
+	var handled []string
+	l.SetErrorHandler(func(item string, err error) {
+		mu.Lock()
+		handled = append(handled, item)
+		mu.Unlock()
+	})
+	if h := l.Health(); len(h) != 1 || h[0].Status != "stopped" || h[0].LastError == "" {
+		t.Fatalf("health %+v, want stopped with an error", h)
+	}
+	l.Info("dropped")
+	if err := l.Reopen(); err == nil {
+		t.Fatal("reopened a file in a missing directory")
+	}
+	mu.Lock()
+	if len(handled) != 1 || handled[0] != "file" {
+		t.Errorf("error handler called for %v, want [file]", handled)
+	}
+	mu.Unlock()
+
+	// the item resumes on reopen once the directory exists, while records
+	// keep coming
+	os.Remove(blocked)
+	os.Mkdir(blocked, 0755)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			l.Info("concurrent")
+		}
+	}()
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	l.Info("written")
+	l.Flush()
+	if h := l.Health(); h[0].Status == "stopped" {
+		t.Errorf("health %+v after reopen", h)
+	}
+	data, _ := ioutil.ReadFile(out)
+	if got := string(data); !strings.Contains(got, "written") || strings.Contains(got, "dropped") {
+		t.Errorf("file holds:\n%s", got)
+	}
+}
@@ -0,0 +1,151 @@
+package log4g
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultHTTPTimeout = 10 * time.Second
+
+// httpSender posts the batches of the http based items to their url, with
+// the headers, authentication and compression of their config.
+type httpSender struct {
+	url      string
+	redacted string // the url without its password, for the errors
+	headers  map[string]string
+	username string
+	password string
+	token    string
+	gzip     bool
+	client   *http.Client
+}
+
+// newHTTPSender returns the sender configured by lc. Requests time out
+// after the timeout of lc, so that closing the item never hangs.
+func newHTTPSender(lc *loggerConfig) (*httpSender, error) {
+	if lc.URL == "" {
+		return nil, fmt.Errorf("log4g: %s item without url", lc.Output)
+	}
+	u, err := url.Parse(lc.URL)
+	if err != nil {
+		return nil, err
+	}
+	s := &httpSender{
+		url:      lc.URL,
+		redacted: u.Redacted(),
+		headers:  lc.Headers,
+		username: lc.Username,
+		password: lc.Password,
+		token:    lc.Token,
+		gzip:     lc.Gzip,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if lc.TLSCA != "" || lc.TLSCert != "" || lc.TLSServerName != "" || lc.TLSMinVersion != "" {
+		c, err := tlsConfig(lc)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = c
+	}
+	s.client = &http.Client{
+		Transport: transport,
+		Timeout:   configDuration("timeout", lc.Timeout, defaultHTTPTimeout),
+	}
+	return s, nil
+}
+
+// httpError is the status of a failed request, retried if it is 408, 429
+// or 5xx, after Retry-After if the server said so.
+type httpError struct {
+	url    string
+	status string
+	code   int
+	body   string
+	after  time.Duration
+}
+
+func (e *httpError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("log4g: POST %s: %s", e.url, e.status)
+	}
+	return fmt.Sprintf("log4g: POST %s: %s: %s", e.url, e.status, e.body)
+}
+
+func (e *httpError) retryAfter() time.Duration {
+	if e.code == http.StatusRequestTimeout || e.code == http.StatusTooManyRequests || e.code >= 500 {
+		return e.after
+	}
+	return -1
+}
+
+// post sends body of contentType, gzipped if configured and compress allows
+// it.
+func (s *httpSender) post(body []byte, contentType string, compress bool) error {
+	encoding := ""
+	if s.gzip && compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(body)
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		encoding = "gzip"
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	} else if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	return &httpError{
+		url:    s.redacted,
+		status: resp.Status,
+		code:   resp.StatusCode,
+		body:   strings.TrimSpace(string(msg)),
+		after:  parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, in seconds or
+// as a date, or 0.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return 0
+}
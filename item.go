@@ -1,12 +1,16 @@
 package log4g
 
 import (
+	"errors"
 	"io"
 	"time"
 	"sync"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
+	"sync/atomic"
+	"bytes"
 )
 
 const (
@@ -20,6 +24,8 @@ const (
 	LstdFlags              = Ldate | Ltime
 )
 
+var errItemStopped = errors.New("log4g: logger item stopped")
+
 func newLoggerItem(level Level, prefix string, flag int, output io.Writer, calldepth int) *GenericLoggerItem {
 	logger := new(GenericLoggerItem)
 	logger.level = level
@@ -43,36 +49,142 @@ type GenericLoggerItem struct {
 	mu        sync.Mutex // ensures atomic writes; protects the following fields
 	out       io.Writer  // destination for output
 	buf       []byte     // for accumulating text to write
-	level     Level
+	level     Level      // accessed atomically
+	pinned    Level      // set by SetLevelFor, 0 if none; accessed atomically
+	tempLevel tempLevel
 	prefix    string
 	flag      int
-	stop      bool
+	stop      int32 // 1 once stopped, accessed atomically
+	color     bool  // color the level names that have a color
 	calldepth int
+	stopErr   error // why the item stopped before it had a health
+	metrics   *itemMetrics
+	health    *itemHealth
+	spool     *spool // of a network item, which then never stops
+}
+
+// monitored is implemented by the items embedding GenericLoggerItem, so the
+// logger can hand them their counters and health.
+type monitored interface {
+	monitor(m *itemMetrics, h *itemHealth)
+}
+
+func (l *GenericLoggerItem) monitor(m *itemMetrics, h *itemHealth) {
+	l.metrics = m
+	l.health = h
+	if l.stopped() {
+		h.halt(l.stopErr)
+	}
+	if l.spool != nil {
+		l.spool.start()
+	}
+}
+
+// halt stops the item because of err. It is retried later, see recover.
+func (l *GenericLoggerItem) halt(err error) {
+	atomic.StoreInt32(&l.stop, 1)
+	if l.health == nil {
+		l.stopErr = err
+	} else {
+		l.health.halt(err)
+	}
+}
+
+// recover reopens a stopped item whose writer can be reopened, with a
+// growing delay between the attempts. Reopen resumes the item or halts it
+// again. recover reports whether the item works again.
+func (l *GenericLoggerItem) recover() bool {
+	r, ok := l.out.(interface {
+		Reopen() error
+	})
+	if !ok || !l.health.due() {
+		return false
+	}
+	return r.Reopen() == nil
+}
+
+// down reports whether the item is stopped and failed to recover. An item
+// with a spool is never down.
+func (l *GenericLoggerItem) down() bool {
+	return l.stopped() && l.spool == nil && !l.recover()
+}
+
+func (l *GenericLoggerItem) stopped() bool {
+	return atomic.LoadInt32(&l.stop) != 0
+}
+
+// resume restarts a stopped item.
+func (l *GenericLoggerItem) resume() {
+	atomic.StoreInt32(&l.stop, 0)
+	l.health.recovered()
 }
 
 
 func (l *GenericLoggerItem) GetLevel() Level {
-	return l.level
+	if level := l.getPinned(); level > 0 {
+		return level
+	}
+	return Level(atomic.LoadUint64((*uint64)(&l.level)))
+}
+
+func (l *GenericLoggerItem) SetLevel(level Level) {
+	l.SetLevelFor(level, 0)
+}
+
+// SetLevelFor sets the item level for ttl, see Logger.SetLevelFor. Unlike a
+// level the item takes from its logger, it is kept whatever the logger level.
+func (l *GenericLoggerItem) SetLevelFor(level Level, ttl time.Duration) {
+	l.tempLevel.set(l.getPinned, l.setPinned, level, ttl)
+}
+
+// isPinned reports whether the item level was set with SetLevelFor.
+func (l *GenericLoggerItem) isPinned() bool {
+	return l.getPinned() > 0
+}
+
+func (l *GenericLoggerItem) getPinned() Level {
+	return Level(atomic.LoadUint64((*uint64)(&l.pinned)))
+}
+
+func (l *GenericLoggerItem) setPinned(level Level) {
+	atomic.StoreUint64((*uint64)(&l.pinned), uint64(level))
 }
 
 func (l *GenericLoggerItem) Before(t time.Time) {
 
 }
 
+// depthLogger is implemented by the items embedding GenericLoggerItem, so
+// the logger can pass the depth of the caller and bypass the item level.
+type depthLogger interface {
+	logDepth(t time.Time, calldepth int, level Level, force bool, arg interface{}, args ...interface{}) (n int, err error)
+}
+
 func (l *GenericLoggerItem) Log(t time.Time, level Level, arg interface{}, args ...interface{}) (n int, err error) {
+	return l.logDepth(t, l.calldepth+1, level, false, arg, args...)
+}
+
+// logDepth logs for the caller calldepth frames above output. With force
+// the item level is ignored.
+func (l *GenericLoggerItem) logDepth(t time.Time, calldepth int, level Level, force bool, arg interface{}, args ...interface{}) (n int, err error) {
 
-	if l.stop || level > l.level {
+	if !force && level > l.GetLevel() {
+		return
+	}
+	if l.down() {
+		l.metrics.dropped()
 		return
 	}
 
+	arg, args, fields := splitFields(arg, args)
 	var text string
 	switch arg.(type) {
 	case string:
 		text = fmt.Sprintf(arg.(string), args...)
-		n, err = l.output(t, l.calldepth, level, text)
+		n, err = l.output(t, calldepth, level, text, fields)
 	default:
 		text = fmt.Sprintf(fmt.Sprintf("%v", arg), args...)
-		n, err = l.output(t, l.calldepth, level, text)
+		n, err = l.output(t, calldepth, level, text, fields)
 	}
 	if level == LEVEL_FATAL {
 		os.Exit(1)
@@ -83,32 +195,59 @@ func (l *GenericLoggerItem) Log(t time.Time, level Level, arg interface{}, args
 	return
 }
 
-func (l *GenericLoggerItem) output(t time.Time, calldepth int, level Level, s string) (n int, err error) {
+func (l *GenericLoggerItem) output(t time.Time, calldepth int, level Level, s string, fields Fields) (n int, err error) {
 
 	var file string
 	var line int
+	var pc uintptr
+	w, structured := l.out.(recordWriter)
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.flag&(Lshortfile|Llongfile) != 0 {
+	if structured || l.flag&(Lshortfile|Llongfile) != 0 {
 		// release lock while getting caller info - it's expensive.
 		l.mu.Unlock()
 		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
+		pc, file, line, ok = runtime.Caller(calldepth)
 		if !ok {
 			file = "???"
 			line = 0
 		}
 		l.mu.Lock()
 	}
+	if structured {
+		r := &record{t, level, l.prefix, l.flag, file, line, "", strings.TrimSuffix(s, "\n"), fields}
+		if f := runtime.FuncForPC(pc); f != nil {
+			r.function = f.Name()
+		}
+		return w.writeRecord(r)
+	}
 	l.buf = l.buf[:0]
 	l.formatHeader(&l.buf, t, level, file, line)
 	l.buf = append(l.buf, s...)
-	if len(s) == 0 || s[len(s)-1] != '\n' {
+	if len(fields) > 0 {
+		l.buf = bytes.TrimSuffix(l.buf, []byte{'\n'})
+		l.buf = fields.appendText(l.buf)
+	}
+	if len(l.buf) == 0 || l.buf[len(l.buf)-1] != '\n' {
 		l.buf = append(l.buf, '\n')
 	}
+	if tw, ok := l.out.(timedWriter); ok {
+		return tw.writeAt(t, l.buf)
+	}
 	return l.out.Write(l.buf)
 }
 
+// timedWriter is implemented by the writers that need the time of the
+// records they write, such as daily rotated files.
+type timedWriter interface {
+	writeAt(t time.Time, p []byte) (n int, err error)
+}
+
+// writer returns the destination of the formatted records.
+func (l *GenericLoggerItem) writer() io.Writer {
+	return l.out
+}
+
 func (l *GenericLoggerItem) After(t time.Time, n int) {
 
 }
@@ -168,7 +307,14 @@ func (l *GenericLoggerItem) formatHeader(buf *[]byte, t time.Time, level Level,
 		}
 	}
 
-	*buf = append(*buf, getAlignedName(level)...)
+	levels := currentLevels()
+	if code, ok := levels.colors[level]; ok && l.color {
+		*buf = append(*buf, "\x1b["+code+"m"...)
+		*buf = append(*buf, levels.alignedNames[level]...)
+		*buf = append(*buf, "\x1b[0m"...)
+	} else {
+		*buf = append(*buf, levels.alignedNames[level]...)
+	}
 	*buf = append(*buf, ' ')
 
 	if l.flag&(Lshortfile|Llongfile) != 0 {
@@ -7,6 +7,7 @@ import (
 func newStdoutLoggerItem(level Level, prefix string, flag int, calldepth int) *StdoutLoggerItem {
 	item := new (StdoutLoggerItem)
 	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, os.Stdout, calldepth)
+	item.color = true
 	return item
 }
 
@@ -17,6 +18,7 @@ type StdoutLoggerItem struct {
 func newStderrLoggerItem(level Level, prefix string, flag int, calldepth int) *StderrLoggerItem {
 	item := new (StderrLoggerItem)
 	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, os.Stdout, calldepth)
+	item.color = true
 	return item
 }
 
@@ -0,0 +1,213 @@
+package log4g
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultCooldown = 30 * time.Second
+
+// newFailoverLoggerItem returns an item writing each record to the first of
+// the items of lc that works, in order. A child that fails lc.Failures times
+// in a row is skipped for lc.Cooldown, then tried again.
+func newFailoverLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, config *Config, refs map[string]LoggerItem, calldepth int) LoggerItem {
+	item := new(FailoverLoggerItem)
+	item.failures = lc.Failures
+	if item.failures <= 0 {
+		item.failures = 1
+	}
+	item.cooldown = configDuration("cooldown", lc.Cooldown, defaultCooldown)
+	taken := make(map[string]bool)
+	for i, clc := range lc.Items {
+		if clc.Disabled {
+			continue
+		}
+		if child := newItem(clc, config, refs, calldepth); child != nil {
+			item.children = append(item.children, &failoverChild{item: child, label: itemLabel(clc, i, taken)})
+		}
+	}
+	if len(item.children) == 0 {
+		log.Printf("log4g: failover %s has no items", lc.Name)
+		return nil
+	}
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	return item
+}
+
+// FailoverLoggerItem writes to its primary child and switches to the next
+// one on errors, or while the breaker of the primary is open. Each child
+// filters and formats the record with its own level, prefix, flag and codec. The item is also the writer of items referencing it.
+type FailoverLoggerItem struct {
+	*GenericLoggerItem
+	children []*failoverChild
+	failures int
+	cooldown time.Duration
+	fmu      sync.Mutex // protects active and the state of the children
+	active   int
+}
+
+type failoverChild struct {
+	item      LoggerItem
+	label     string
+	metrics   *itemMetrics
+	health    *itemHealth
+	errors    int       // consecutive errors
+	openUntil time.Time // the child is skipped until then
+}
+
+func (l *FailoverLoggerItem) monitor(m *itemMetrics, h *itemHealth) {
+	l.GenericLoggerItem.monitor(m, h)
+	for _, c := range l.children {
+		label := h.item + "/" + c.label
+		c.metrics = metricsFor(h.logger.label, label)
+		c.health = &itemHealth{item: label, logger: h.logger}
+		if g, ok := c.item.(monitored); ok {
+			g.monitor(c.metrics, c.health)
+		}
+		h.children = append(h.children, c.health)
+	}
+}
+
+func (l *FailoverLoggerItem) Log(t time.Time, level Level, arg interface{}, args ...interface{}) (n int, err error) {
+	return l.logDepth(t, l.calldepth+1, level, false, arg, args...)
+}
+
+func (l *FailoverLoggerItem) logDepth(t time.Time, calldepth int, level Level, force bool, arg interface{}, args ...interface{}) (n int, err error) {
+	if !force && level > l.GetLevel() {
+		return
+	}
+	admits := func(item LoggerItem) bool {
+		return force || level <= item.GetLevel()
+	}
+	return l.try(admits, func(item LoggerItem) (int, error) {
+		if d, ok := item.(depthLogger); ok {
+			return d.logDepth(t, calldepth+3, level, force, arg, args...)
+		}
+		return item.Log(t, level, arg, args...)
+	})
+}
+
+// Write writes the records of the items referencing l.
+func (l *FailoverLoggerItem) Write(p []byte) (n int, err error) {
+	admits := func(item LoggerItem) bool {
+		return true
+	}
+	return l.try(admits, func(item LoggerItem) (int, error) {
+		w, ok := item.(interface {
+			writer() io.Writer
+		})
+		if !ok {
+			return 0, errItemStopped
+		}
+		return w.writer().Write(p)
+	})
+}
+
+// try calls write with the available children, in order, until one writes
+// the record. The first of them whose level filters the record out drops it:
+// levels never route records to the next child. A child that writes nothing
+// dropped the record and failed like one returning an error. try returns
+// errItemStopped if no child took the record.
+func (l *FailoverLoggerItem) try(admits func(item LoggerItem) bool, write func(item LoggerItem) (int, error)) (n int, err error) {
+	err = errItemStopped
+	for i, c := range l.children {
+		if !l.available(c) {
+			continue
+		}
+		if !admits(c.item) {
+			return 0, nil
+		}
+		n, err = write(c.item)
+		if err == nil && n > 0 {
+			l.succeeded(i, c, n)
+			return
+		}
+		l.failed(c, err)
+		if err == nil {
+			err = errItemStopped
+		}
+	}
+	return 0, err
+}
+
+// available reports whether c may be written to: its breaker is closed or
+// its cooldown is over, and it is not stopped.
+func (l *FailoverLoggerItem) available(c *failoverChild) bool {
+	l.fmu.Lock()
+	open := time.Now().Before(c.openUntil)
+	l.fmu.Unlock()
+	if open {
+		return false
+	}
+	if g, ok := c.item.(interface {
+		down() bool
+	}); ok && g.down() {
+		return false
+	}
+	return true
+}
+
+func (l *FailoverLoggerItem) succeeded(i int, c *failoverChild, n int) {
+	if n > 0 {
+		c.metrics.written(n)
+	}
+	l.fmu.Lock()
+	defer l.fmu.Unlock()
+	c.errors = 0
+	c.openUntil = time.Time{}
+	if l.active != i {
+		l.active = i
+		l.metrics.switched()
+	}
+}
+
+// failed counts an error of c, or a record it dropped, towards opening its
+// breaker. A nil err stands for a record c dropped and counted itself.
+func (l *FailoverLoggerItem) failed(c *failoverChild, err error) {
+	dropped := err == nil || err == errItemStopped || err == errQueueFull
+	if err == errItemStopped || err == errQueueFull {
+		c.metrics.dropped()
+	} else if err != nil {
+		c.metrics.failed()
+	}
+	l.fmu.Lock()
+	c.errors++
+	if c.errors >= l.failures {
+		c.errors = 0
+		c.openUntil = time.Now().Add(l.cooldown)
+	}
+	l.fmu.Unlock()
+	if !dropped {
+		c.health.fail(err)
+	}
+}
+
+func (l *FailoverLoggerItem) Flush() {
+	for _, c := range l.children {
+		c.item.Flush()
+	}
+}
+
+// Reopen reopens the children that can be reopened. It returns the last
+// error met.
+func (l *FailoverLoggerItem) Reopen() error {
+	var err error
+	for _, c := range l.children {
+		if r, ok := c.item.(interface {
+			Reopen() error
+		}); ok {
+			if e := r.Reopen(); e != nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (l *FailoverLoggerItem) Close() {
+	for _, c := range l.children {
+		c.item.Close()
+	}
+}
@@ -0,0 +1,80 @@
+package log4g
+
+import (
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailoverLevels(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"level": "info", "items": [
+		{"name": "out", "output": "failover", "items": [
+			{"output": "file", "filename": "$OUT.errors", "level": "error"},
+			{"output": "file", "filename": "$OUT"}
+		]}
+	]}`)
+	defer cleanup()
+	switches := atomic.LoadInt64(&l.metrics[0].switches)
+	l.Info("filtered by the primary")
+	l.Error("to the primary")
+	l.Debug("nowhere")
+
+	// the level of the primary drops records, it does not route them
+	if got := read(); got != "" {
+		t.Errorf("fallback holds:\n%s", got)
+	}
+	primary := l.items[0].(*FailoverLoggerItem).children[0].item.(*FileLoggerItem)
+	data, _ := ioutil.ReadFile(primary.filename)
+	if !strings.Contains(string(data), "to the primary") || strings.Contains(string(data), "filtered") {
+		t.Errorf("primary holds:\n%s", data)
+	}
+	if n := atomic.LoadInt64(&l.metrics[0].switches) - switches; n != 0 {
+		t.Errorf("%d switches on records filtered by level", n)
+	}
+	for _, h := range l.Health()[0].Children {
+		if h.Status != "healthy" {
+			t.Errorf("child %+v after records filtered by level", h)
+		}
+	}
+}
+
+func TestFailoverOnErrors(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"items": [
+		{"name": "out", "output": "failover", "cooldown": "1h", "items": [
+			{"output": "socket", "network": "tcp", "address": "127.0.0.1:1", "dial_timeout": "100ms"},
+			{"output": "file", "filename": "$OUT"}
+		]}
+	]}`)
+	defer cleanup()
+	var mu sync.Mutex
+	var failed []string
+	l.SetErrorHandler(func(item string, err error) {
+		mu.Lock()
+		failed = append(failed, item)
+		mu.Unlock()
+	})
+	switches := atomic.LoadInt64(&l.metrics[0].switches)
+	l.Info("first")
+	l.Info("second")
+
+	got := read()
+	if !strings.Contains(got, "first") || !strings.Contains(got, "second") {
+		t.Errorf("fallback holds:\n%s", got)
+	}
+	// the socket stops once its dial fails
+	deadline := time.Now().Add(3 * time.Second)
+	for l.Health()[0].Children[0].Status != "stopped" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	if len(failed) == 0 || failed[0] != "out/socket" {
+		t.Errorf("errors of %v, want out/socket", failed)
+	}
+	mu.Unlock()
+	if n := atomic.LoadInt64(&l.metrics[0].switches) - switches; n != 1 {
+		t.Errorf("%d switches, want 1", n)
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"bufio"
 )
@@ -51,16 +51,20 @@ func newFileLoggerItem(level Level, prefix string, flag int, filename string, bu
 	fileLogger.daily = daily
 	fileLogger.lines = lineCounter(filename)
 
+	fileLogger.GenericLoggerItem = newLoggerItem(level, prefix, flag, fileLogger, calldepth)
+
 	output, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
 	if err != nil {
-		log.Print(err)
-		return nil
+		fileLogger.halt(err)
+		return fileLogger
 	}
 	fileLogger.file = output
 	info, err := output.Stat()
 	if err != nil {
-		log.Print(err)
-		return nil
+		output.Close()
+		fileLogger.file = nil
+		fileLogger.halt(err)
+		return fileLogger
 	}
 
 	fileLogger.size = info.Size()
@@ -78,20 +82,21 @@ func newFileLoggerItem(level Level, prefix string, flag int, filename string, bu
 		return nil
 	})
 
-	var out io.Writer
 	if buffer {
-		out = bufio.NewWriterSize(output, bufferSize)
+		fileLogger.out = bufio.NewWriterSize(output, bufferSize)
 	} else {
-		out = output
+		fileLogger.out = output
 	}
 
-	fileLogger.GenericLoggerItem = newLoggerItem(level, prefix, flag, out, calldepth)
-
 	return fileLogger
 }
 
+// FileLoggerItem is also the writer of its GenericLoggerItem, so items
+// referencing it from other loggers share the file and its rotation.
 type FileLoggerItem struct {
 	*GenericLoggerItem
+	wmu      sync.Mutex // serializes writes and rotation; protects the following fields
+	out      io.Writer
 	filename string
 	filedir  string
 	file     *os.File
@@ -107,10 +112,28 @@ type FileLoggerItem struct {
 	lastTime time.Time
 }
 
-func (l *FileLoggerItem) Before(t time.Time) {
+func (l *FileLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeAt(time.Now(), p)
+}
+
+// writeAt writes p, a record logged at t, so that the daily rotation goes by
+// the time of the record whichever item, owner or ref, formatted it.
+func (l *FileLoggerItem) writeAt(t time.Time, p []byte) (n int, err error) {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+
+	if l.stopped() {
+		return 0, errItemStopped
+	}
+
 	if l.daily {
 		l.dailyBackup(t)
 	}
+	n, err = l.out.Write(p)
+	if err == nil {
+		l.rotate(t, n)
+	}
+	return
 }
 
 func (l *FileLoggerItem) dailyBackup(t time.Time) {
@@ -120,14 +143,11 @@ func (l *FileLoggerItem) dailyBackup(t time.Time) {
 		nowYear, nowMonth, nowDay := t.Date()
 		if ltDay != nowDay || ltMonth != nowMonth || ltYear != nowYear {
 
-			l.mu.Lock()
-			defer l.mu.Unlock()
-
 			strDate := fmt.Sprintf("%d%02d%02d", ltYear, ltMonth, ltDay)
 			dateDir := filepath.Join(l.filedir, strDate)
 			err := os.MkdirAll(dateDir, os.ModePerm)
 			if err == nil {
-				l.Close()
+				l.closeFile()
 				//move all file to date director
 				err = filepath.Walk(l.filedir, func(path string, info os.FileInfo, err error) error {
 					if info.IsDir() {
@@ -140,19 +160,20 @@ func (l *FileLoggerItem) dailyBackup(t time.Time) {
 					return nil
 				})
 				if err != nil {
-					Error(err)
+					l.health.fail(err)
 					return
 				}
 				l.count = 0
 				l.newOutput()
+				l.metrics.rotated()
 			} else {
-				Error(err)
+				l.health.fail(err)
 			}
 		}
 	}
 }
 
-func (l *FileLoggerItem) After(t time.Time, n int) {
+func (l *FileLoggerItem) rotate(t time.Time, n int) {
 
 	if n <= 0 {
 		return
@@ -160,22 +181,17 @@ func (l *FileLoggerItem) After(t time.Time, n int) {
 
 	l.lastTime = t
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
 	l.lines++
 	l.size += int64(n)
 	if (l.maxlines > 0 && l.lines >= l.maxlines) || (l.maxsize > 0 && l.size > l.maxsize) {
 
-		log.Printf("lines=%d,maxlines=%d,count=%d", l.lines, l.maxlines, l.count)
-
 		//close log file
-		l.Close()
+		l.closeFile()
 
 		//remove the oldest log
 		if l.count == l.maxcount {
-			if os.Remove(fmt.Sprintf(l.format, l.filename, l.maxcount-1)) != nil {
-				l.stop = true
+			if err := os.Remove(fmt.Sprintf(l.format, l.filename, l.maxcount-1)); err != nil {
+				l.halt(err)
 				return
 			}
 			l.count--
@@ -193,13 +209,13 @@ func (l *FileLoggerItem) After(t time.Time, n int) {
 			newpath := fmt.Sprintf(l.format, l.filename, i)
 			err = os.Rename(oldpath, newpath)
 			if err != nil {
-				log.Println(err)
-				l.stop = true
+				l.halt(err)
 				return
 			}
 		}
 
 		l.newOutput()
+		l.metrics.rotated()
 
 	}
 }
@@ -208,7 +224,7 @@ func (l *FileLoggerItem) newOutput() {
 	//create new log file
 	output, err := os.OpenFile(l.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
 	if err != nil {
-		l.stop = true
+		l.halt(err)
 	}
 	l.file = output
 	if l.buffer {
@@ -221,12 +237,53 @@ func (l *FileLoggerItem) newOutput() {
 	l.count++
 }
 
+// Reopen closes the file and opens it again at its path, so that records go
+// to a new file after an external tool moved the old one. It also resumes a
+// stopped item, and stops it if the file cannot be opened.
+func (l *FileLoggerItem) Reopen() error {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.closeFile()
+	output, err := os.OpenFile(l.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		l.halt(err)
+		return err
+	}
+	info, err := output.Stat()
+	if err != nil {
+		output.Close()
+		l.halt(err)
+		return err
+	}
+	l.file = output
+	if l.buffer {
+		l.out = bufio.NewWriterSize(output, bufferSize)
+	} else {
+		l.out = output
+	}
+	l.size = info.Size()
+	l.lines = lineCounter(l.filename)
+	l.resume()
+	return nil
+}
+
 func (l *FileLoggerItem) Flush() {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
 	if writer, ok := l.out.(*bufio.Writer); ok {
 		writer.Flush()
 	}
 }
 
-func (l *FileLoggerItem) Close() {
+func (l *FileLoggerItem) closeFile() {
+	if writer, ok := l.out.(*bufio.Writer); ok {
+		writer.Flush()
+	}
 	l.file.Close()
 }
+
+func (l *FileLoggerItem) Close() {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.closeFile()
+}
@@ -0,0 +1,82 @@
+package log4g
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileRotation(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"items": [{"output": "file", "filename": "$OUT", "max_lines": 2, "max_count": 3}]}`)
+	defer cleanup()
+	for i := 1; i <= 7; i++ {
+		l.Info("line %d", i)
+	}
+	out := l.items[0].(*FileLoggerItem).filename
+	for name, want := range map[string]string{
+		out:        "line 7\n",
+		out + ".1": "line 5\n line 6\n",
+		out + ".2": "line 3\n line 4\n",
+	} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			if i := strings.Index(line, "line "); i >= 0 {
+				lines = append(lines, line[i:])
+			}
+		}
+		if got := strings.Join(lines, " "); got != want {
+			t.Errorf("%s holds %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(out + ".3"); err == nil {
+		t.Error("more than max_count files kept")
+	}
+	if !strings.Contains(read(), "line 7") {
+		t.Error("last line not in the current file")
+	}
+}
+
+func TestFileRefSharesOutput(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{
+		"prefix": "[app] ",
+		"items": [{"name": "file", "output": "file", "filename": "$OUT", "daily": true}],
+		"loggers": {"db": {"prefix": "[db] ", "level": "warn", "items": [{"ref": "file"}]}}
+	}`)
+	defer cleanup()
+	db := l.Named("db")
+	l.Info("from app")
+	db.Info("hidden")
+	db.Warn("from db")
+
+	got := read()
+	for _, s := range []string{"[app] ", "from app", "[db] ", "from db"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not written:\n%s", s, got)
+		}
+	}
+	if strings.Contains(got, "hidden") {
+		t.Errorf("record below the ref level written:\n%s", got)
+	}
+
+	// a ref record of the day of the last write does not rotate, whatever
+	// the current time
+	file := l.items[0].(*FileLoggerItem)
+	yesterday := time.Now().Add(-24 * time.Hour)
+	file.wmu.Lock()
+	file.lastTime = yesterday
+	file.wmu.Unlock()
+	db.items[0].Log(yesterday, LEVEL_WARN, "late")
+	if dirs, _ := filepath.Glob(filepath.Join(file.filedir, yesterday.Format("20060102"))); len(dirs) > 0 {
+		t.Error("ref record rotated the file by the current time")
+	}
+	if !strings.Contains(read(), "late") {
+		t.Error("ref record not written")
+	}
+}
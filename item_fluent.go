@@ -0,0 +1,172 @@
+package log4g
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFluentAddress = "127.0.0.1:24224"
+	// the length of a chunk id: 16 random bytes in base64
+	fluentChunkSize = 24
+)
+
+// newFluentLoggerItem returns an item sending batches of events to a fluentd
+// or fluent-bit Forward input at the address of lc, by default on the local
+// host.
+func newFluentLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
+	if lc.Address == "" && len(lc.Addresses) == 0 {
+		lc.Address = defaultFluentAddress
+	}
+	if lc.Network == "" {
+		lc.Network = "tcp"
+	}
+	item := &FluentLoggerItem{SocketLoggerItem: newSocket(lc)}
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	item.init()
+
+	item.tag = lc.Tag
+	if item.tag == "" {
+		item.tag = fluentTag(prefix)
+	}
+	if lc.Ack {
+		item.ack = item.readAck
+	}
+	item.batch = newBatcher(lc, item.GenericLoggerItem, item.sendBatch)
+	return item
+}
+
+// fluentTag returns a tag made of the words of s, such as a prefix
+// "[billing] ", joined by dots.
+func fluentTag(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+	})
+	return strings.Join(words, ".")
+}
+
+// FluentLoggerItem speaks the fluentd Forward protocol over the socket
+// transport. Its records are queued and sent in PackedForward batches,
+// acknowledged by the server with ack, so that along with a spool each
+// batch is delivered at least once.
+type FluentLoggerItem struct {
+	*SocketLoggerItem
+	tag   string
+	batch *batcher
+}
+
+func (l *FluentLoggerItem) monitor(m *itemMetrics, h *itemHealth) {
+	l.SocketLoggerItem.monitor(m, h)
+	if l.tag == "" {
+		// the executable, and the logger for a named logger
+		l.tag = fluentTag(appName())
+		if h.logger != nil && h.logger.name != "" {
+			l.tag += "." + fluentTag(h.logger.name)
+		}
+	}
+	l.batch.start()
+}
+
+// Write queues the text of a record written through a ref, at level info.
+func (l *FluentLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeRecord(&record{time: time.Now(), level: LEVEL_INFO, message: strings.TrimSuffix(string(p), "\n")})
+}
+
+// writeRecord queues the event of r: its time and a map of its fields, its
+// message, level and caller.
+func (l *FluentLoggerItem) writeRecord(r *record) (n int, err error) {
+	m := make(map[string]interface{}, len(r.fields)+5)
+	for k, v := range r.fields {
+		m[k] = v
+	}
+	m["message"] = r.prefix + r.message
+	m["level"] = r.level.Name()
+	if r.file != "" && r.file != "???" {
+		m["file"] = path.Base(r.file)
+		m["line"] = r.line
+	}
+	if r.function != "" {
+		m["function"] = r.function
+	}
+	data := appendMsgpackArray(nil, 2)
+	data = appendEventTime(data, r.time)
+	data = appendMsgpackFields(data, m)
+	return l.batch.add(batchEntry{time: r.time, data: data})
+}
+
+// sendBatch sends batch as a PackedForward message, with a chunk id the
+// server acknowledges if ack is on. The chunk is the last option, so that
+// its id ends the message.
+func (l *FluentLoggerItem) sendBatch(batch []batchEntry) error {
+	size := 0
+	for _, e := range batch {
+		size += len(e.data)
+	}
+	entries := make([]byte, 0, size)
+	for _, e := range batch {
+		entries = append(entries, e.data...)
+	}
+	p := appendMsgpackArray(make([]byte, 0, size+len(l.tag)+64), 3)
+	p = appendMsgpackString(p, l.tag)
+	p = appendMsgpackBin(p, entries)
+	if l.ack != nil {
+		p = appendMsgpackMap(p, 2)
+	} else {
+		p = appendMsgpackMap(p, 1)
+	}
+	p = appendMsgpackString(p, "size")
+	p = appendMsgpackInt(p, int64(len(batch)))
+	if l.ack != nil {
+		var id [16]byte
+		rand.Read(id[:])
+		p = appendMsgpackString(p, "chunk")
+		p = appendMsgpackString(p, base64.StdEncoding.EncodeToString(id[:]))
+	}
+	return l.batch.retry(func() error {
+		_, err := l.deliver(p)
+		return err
+	})
+}
+
+// readAck reads the reply of the server to the message p and checks that
+// it acknowledges the chunk id ending p.
+func (l *FluentLoggerItem) readAck(conn net.Conn, p []byte) error {
+	if len(p) < fluentChunkSize {
+		return fmt.Errorf("log4g: fluent: message of %d bytes without a chunk", len(p))
+	}
+	chunk := string(p[len(p)-fluentChunkSize:])
+	var reply []byte
+	buf := make([]byte, 128)
+	for {
+		n, err := conn.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if v, _, derr := decodeMsgpack(reply); derr == nil {
+			if m, ok := v.(map[string]interface{}); !ok || m["ack"] != chunk {
+				return fmt.Errorf("log4g: fluent: unexpected reply %v to chunk %v", v, chunk)
+			}
+			return nil
+		} else if derr != io.ErrUnexpectedEOF {
+			return derr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Flush sends the queued events and waits until they are sent.
+func (l *FluentLoggerItem) Flush() {
+	l.batch.flush()
+}
+
+// Close sends the queued events and closes the connections.
+func (l *FluentLoggerItem) Close() {
+	l.batch.close()
+	l.SocketLoggerItem.Close()
+}
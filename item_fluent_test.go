@@ -0,0 +1,172 @@
+package log4g
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// forwardServer is a small Forward input decoding the PackedForward
+// messages sent to it, and acknowledging their chunks.
+type forwardServer struct {
+	ln     net.Listener
+	events chan forwardEvent
+	drops  int32 // chunks to drop with their connection instead of acknowledging
+}
+
+type forwardEvent struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+func newForwardServer(t *testing.T) *forwardServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &forwardServer{ln: ln, events: make(chan forwardEvent, 100)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(t, conn)
+		}
+	}()
+	return s
+}
+
+func (s *forwardServer) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		data = append(data, buf[:n]...)
+		for {
+			v, m, derr := decodeMsgpack(data)
+			if derr == io.ErrUnexpectedEOF {
+				break
+			} else if derr != nil {
+				t.Error(derr)
+				return
+			}
+			data = data[m:]
+			msg := v.([]interface{})
+			option := msg[2].(map[string]interface{})
+			chunk, ok := option["chunk"]
+			if ok && atomic.AddInt32(&s.drops, -1) >= 0 {
+				return
+			}
+			for entries := msg[1].([]byte); len(entries) > 0; {
+				e, m, err := decodeMsgpack(entries)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				entries = entries[m:]
+				ev := e.([]interface{})
+				et := ev[0].(msgpackExt)
+				s.events <- forwardEvent{
+					tag:    msg[0].(string),
+					time:   time.Unix(int64(binary.BigEndian.Uint32(et.data)), int64(binary.BigEndian.Uint32(et.data[4:]))),
+					record: ev[1].(map[string]interface{}),
+				}
+			}
+			if ok {
+				conn.Write(appendMsgpackFields(nil, map[string]interface{}{"ack": chunk}))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *forwardServer) next(t *testing.T) forwardEvent {
+	select {
+	case e := <-s.events:
+		return e
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event")
+	}
+	return forwardEvent{}
+}
+
+func TestFluentForward(t *testing.T) {
+	s := newForwardServer(t)
+	defer s.ln.Close()
+	l := itemLogger(t, `"prefix": "[billing] "`, `{"output":"fluent","address":"`+s.ln.Addr().String()+`","batch_wait":"1h"}`)
+	defer l.Close()
+	waitConnected(t, l)
+
+	before := time.Now()
+	l.Warn("disk %s", "full", Fields{"user_id": 7, "ratio": 0.5})
+	l.Info("second")
+	l.Flush()
+
+	e := s.next(t)
+	if e.tag != "billing" {
+		t.Errorf("tag = %q", e.tag)
+	}
+	if e.time.Before(before) || e.time.After(time.Now()) {
+		t.Errorf("time = %v", e.time)
+	}
+	want := map[string]interface{}{
+		"message":  "[billing] disk full",
+		"level":    "WARN",
+		"file":     "item_fluent_test.go",
+		"function": "github.com/carsonsx/log4g.TestFluentForward",
+		"user_id":  int64(7),
+		"ratio":    0.5,
+	}
+	for k, v := range want {
+		if e.record[k] != v {
+			t.Errorf("%s = %v, want %v", k, e.record[k], v)
+		}
+	}
+	if _, ok := e.record["line"].(int64); !ok {
+		t.Errorf("line = %v", e.record["line"])
+	}
+	if e = s.next(t); e.record["message"] != "[billing] second" {
+		t.Errorf("message = %v", e.record["message"])
+	}
+}
+
+func TestFluentAckResends(t *testing.T) {
+	s := newForwardServer(t)
+	defer s.ln.Close()
+	s.drops = 1
+	l := itemLogger(t, `"prefix": "[billing] "`, `{"output":"fluent","address":"`+s.ln.Addr().String()+`","tag":"app.billing","ack":true}`)
+	defer l.Close()
+	waitConnected(t, l)
+
+	l.Info("once")
+	l.Flush()
+	if e := s.next(t); e.tag != "app.billing" || e.record["message"] != "[billing] once" {
+		t.Errorf("event %v", e)
+	}
+	select {
+	case e := <-s.events:
+		t.Errorf("unexpected event %v", e)
+	default:
+	}
+}
+
+func TestFluentCloseSendsQueued(t *testing.T) {
+	s := newForwardServer(t)
+	defer s.ln.Close()
+	l := itemLogger(t, `"prefix": "[billing] "`, `{"output":"fluent","address":"`+s.ln.Addr().String()+`","batch_wait":"1h"}`)
+	waitConnected(t, l)
+
+	l.Info("queued")
+	l.Close()
+	if e := s.next(t); e.record["message"] != "[billing] queued" {
+		t.Errorf("message = %v", e.record["message"])
+	}
+}
@@ -0,0 +1,192 @@
+package log4g
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGelfChunkSize = 1420
+	gelfChunkHeader      = 12
+	gelfMaxChunks        = 128
+)
+
+// newGelfLoggerItem returns an item sending GELF messages to the address
+// of lc, compressed and chunked on udp and null terminated on streams.
+func newGelfLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
+	if lc.Network == "" {
+		lc.Network = "udp"
+	}
+	item := &GelfLoggerItem{SocketLoggerItem: newSocket(lc)}
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	item.init()
+
+	item.hostname, _ = os.Hostname()
+	item.severities = newSeverities(lc.Severities)
+	if !item.stream() {
+		switch lc.Compression {
+		case "", "none", "gzip", "zlib":
+			item.compression = lc.Compression
+		default:
+			log.Printf("log4g: invalid compression %s", lc.Compression)
+		}
+		item.chunkSize = lc.ChunkSize
+		if item.chunkSize <= gelfChunkHeader {
+			item.chunkSize = defaultGelfChunkSize
+		}
+		item.split = item.chunks
+	}
+	return item
+}
+
+// GelfLoggerItem writes GELF 1.1 messages for Graylog over the socket
+// transport, so it reconnects, balances and spools like a socket item.
+type GelfLoggerItem struct {
+	*SocketLoggerItem
+	hostname    string
+	severities  severities
+	compression string
+	chunkSize   int
+}
+
+// Write sends the text of a record written through a ref, at level info.
+func (l *GelfLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeRecord(&record{time: time.Now(), level: LEVEL_INFO, message: strings.TrimSuffix(string(p), "\n")})
+}
+
+func (l *GelfLoggerItem) writeRecord(r *record) (n int, err error) {
+	p, err := l.encode(r)
+	if err != nil {
+		return 0, err
+	}
+	if l.stream() {
+		return l.deliver(append(p, 0))
+	}
+	if max := gelfMaxChunks * (l.chunkSize - gelfChunkHeader); len(p) > max {
+		return 0, fmt.Errorf("log4g: gelf message of %d bytes over %d chunks", len(p), gelfMaxChunks)
+	}
+	return l.deliver(p)
+}
+
+// encode returns the GELF message of r, compressed as configured. A message
+// of several lines, such as a stack, is the full_message, and its first line
+// the short_message.
+func (l *GelfLoggerItem) encode(r *record) ([]byte, error) {
+	msg := r.prefix + r.message
+	m := map[string]interface{}{
+		"version":   "1.1",
+		"host":      l.hostname,
+		"timestamp": float64(r.time.UnixNano()/int64(time.Millisecond)) / 1000,
+		"level":     l.severities.of(r.level),
+	}
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		m["short_message"] = strings.TrimRight(msg[:i], "\r")
+		m["full_message"] = msg
+	} else {
+		m["short_message"] = msg
+	}
+	if r.file != "" && r.file != "???" {
+		m["_file"] = path.Base(r.file)
+		m["_line"] = r.line
+	}
+	if r.function != "" {
+		m["_function"] = r.function
+	}
+	for k, v := range r.fields {
+		m[gelfFieldName(k)] = gelfValue(v)
+	}
+	p, err := json.Marshal(m)
+	if err != nil || l.compression == "" || l.compression == "none" {
+		return p, err
+	}
+	var buf bytes.Buffer
+	var w interface {
+		Write(p []byte) (int, error)
+		Close() error
+	}
+	if l.compression == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	w.Write(p)
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunks splits the message p into GELF chunks if it is larger than a
+// chunk.
+func (l *GelfLoggerItem) chunks(p []byte) [][]byte {
+	if len(p) <= l.chunkSize {
+		return [][]byte{p}
+	}
+	size := l.chunkSize - gelfChunkHeader
+	count := (len(p) + size - 1) / size
+	var id [8]byte
+	rand.Read(id[:])
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := p[i*size:]
+		if len(data) > size {
+			data = data[:size]
+		}
+		chunk := make([]byte, 0, gelfChunkHeader+len(data))
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, data...))
+	}
+	return chunks
+}
+
+// gelfFieldName returns key as a GELF additional field: prefixed with '_'
+// and made of letters, digits, '_', '.' and '-'. _id is reserved.
+func gelfFieldName(key string) string {
+	b := make([]byte, 0, len(key)+1)
+	b = append(b, '_')
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if i == 0 && c == '_' {
+			continue
+		}
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.', c == '-':
+		default:
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	if string(b) == "_id" {
+		return "_id_"
+	}
+	return string(b)
+}
+
+// gelfValue returns v as a number or a string, the values GELF allows.
+func gelfValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v
+	case float32:
+		if !math.IsNaN(float64(n)) && !math.IsInf(float64(n), 0) {
+			return v
+		}
+	case float64:
+		if !math.IsNaN(n) && !math.IsInf(n, 0) {
+			return v
+		}
+	}
+	return fmt.Sprint(v)
+}
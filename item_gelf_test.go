@@ -0,0 +1,117 @@
+package log4g
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readGelf reads the chunks of a message, checking their headers, and
+// returns the message they carry and their count, 0 if it was not chunked.
+func readGelf(t *testing.T, conn net.PacketConn, chunkSize int) ([]byte, int) {
+	buf := make([]byte, 65536)
+	var msg []byte
+	var id []byte
+	for seq := 0; ; seq++ {
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := buf[:n]
+		if n > chunkSize {
+			t.Fatalf("datagram of %d bytes over %d", n, chunkSize)
+		}
+		if d[0] != 0x1e || d[1] != 0x0f {
+			if seq > 0 {
+				t.Fatalf("unchunked datagram after %d chunks", seq)
+			}
+			return d, 0
+		}
+		if id == nil {
+			id = append(id, d[2:10]...)
+		} else if !bytes.Equal(id, d[2:10]) {
+			t.Fatalf("chunk %d of message %x, want %x", seq, d[2:10], id)
+		}
+		if int(d[10]) != seq {
+			t.Fatalf("chunk %d numbered %d", seq, d[10])
+		}
+		msg = append(msg, d[gelfChunkHeader:]...)
+		if int(d[11]) == seq+1 {
+			return msg, seq + 1
+		}
+	}
+}
+
+func TestGelfChunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	l := itemLogger(t, `"flag": ""`, `{"output": "socket", "codec": "gelf", "address": "`+conn.LocalAddr().String()+`",
+		"chunk_size": 100, "compression": "gzip"}`)
+	defer l.Close()
+	waitConnected(t, l)
+
+	// random enough not to compress into a single chunk
+	var long strings.Builder
+	for i := 0; long.Len() < 2000; i++ {
+		long.WriteString(time.Duration(i * 7919).String())
+	}
+	l.Error("first line\n"+long.String(), Fields{"user id": 7, "_id": "x"})
+	msg, chunks := readGelf(t, conn, 100)
+	if chunks < 2 {
+		t.Errorf("message sent in %d chunks", chunks)
+	}
+	data := mustGunzip(t, msg)
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["version"] != "1.1" || m["short_message"] != "first line" || m["full_message"] != "first line\n"+long.String() ||
+		m["level"] != 3.0 || m["_user_id"] != 7.0 || m["_id_"] != "x" {
+		t.Errorf("message %v", m)
+	}
+}
+
+func TestGelfTooManyChunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	l := itemLogger(t, `"flag": ""`, `{"output": "socket", "codec": "gelf", "address": "`+conn.LocalAddr().String()+`",
+		"chunk_size": 20}`)
+	defer l.Close()
+	waitConnected(t, l)
+
+	// 128 chunks carry 1024 bytes of 20 byte chunks
+	l.Info(strings.Repeat("x", 1100))
+	if h := l.Health()[0]; !strings.Contains(h.LastError, "over 128 chunks") {
+		t.Errorf("health %+v", h)
+	}
+	l.Info("sent")
+	var m map[string]interface{}
+	msg, _ := readGelf(t, conn, 20)
+	if err := json.Unmarshal(msg, &m); err != nil || m["short_message"] != "sent" {
+		t.Errorf("message %v: %v", m, err)
+	}
+}
+
+func mustGunzip(t *testing.T, p []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,124 @@
+package log4g
+
+import (
+	"encoding/json"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// newHTTPLoggerItem returns an item posting batches of records, as NDJSON
+// or plain text lines, to the url of lc.
+func newHTTPLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
+	switch lc.Codec {
+	case "", "json", "plain":
+	default:
+		log.Printf("log4g: invalid codec %s of an http item", lc.Codec)
+		return nil
+	}
+	sender, err := newHTTPSender(lc)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	item := &HTTPLoggerItem{
+		http:       sender,
+		text:       lc.Codec == "plain",
+		messageKey: lc.JsonKey,
+	}
+	if item.messageKey == "" {
+		item.messageKey = "message"
+	}
+	if lc.JsonExt != "" {
+		if err := json.Unmarshal([]byte(lc.JsonExt), &item.ext); err != nil {
+			log.Printf("log4g: invalid json_ext %s: %v", lc.JsonExt, err)
+		}
+	}
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	item.batch = newBatcher(lc, item.GenericLoggerItem, item.sendBatch)
+	return item
+}
+
+// HTTPLoggerItem posts the records to a collector accepting NDJSON, or text
+// lines with the plain codec. Its records are queued and sent in batches.
+type HTTPLoggerItem struct {
+	*GenericLoggerItem
+	http       *httpSender
+	text       bool
+	messageKey string
+	ext        map[string]interface{} // added to every JSON record
+	batch      *batcher
+}
+
+func (l *HTTPLoggerItem) monitor(m *itemMetrics, h *itemHealth) {
+	l.GenericLoggerItem.monitor(m, h)
+	l.batch.start()
+}
+
+// Write queues the text of a record written through a ref, at level info.
+func (l *HTTPLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeRecord(&record{time: time.Now(), level: LEVEL_INFO, message: strings.TrimSuffix(string(p), "\n")})
+}
+
+// writeRecord queues the line of r: its text as other outputs write it, or
+// a JSON object of its time, level, message, caller and fields.
+func (l *HTTPLoggerItem) writeRecord(r *record) (n int, err error) {
+	var line []byte
+	if l.text {
+		l.formatHeader(&line, r.time, r.level, r.file, r.line)
+		line = append(line, r.message...)
+		line = r.fields.appendText(line)
+	} else {
+		m := make(map[string]interface{}, len(l.ext)+len(r.fields)+6)
+		for k, v := range l.ext {
+			m[k] = v
+		}
+		for k, v := range r.fields {
+			m[k] = v
+		}
+		m["time"] = r.time.Format(time.RFC3339Nano)
+		m["level"] = r.level.Name()
+		m[l.messageKey] = r.prefix + r.message
+		if r.file != "" && r.file != "???" {
+			m["file"] = path.Base(r.file)
+			m["line"] = r.line
+		}
+		if r.function != "" {
+			m["function"] = r.function
+		}
+		if line, err = json.Marshal(m); err != nil {
+			return 0, err
+		}
+	}
+	return l.batch.add(batchEntry{time: r.time, data: append(line, '\n')})
+}
+
+// sendBatch posts the lines of batch.
+func (l *HTTPLoggerItem) sendBatch(batch []batchEntry) error {
+	size := 0
+	for _, e := range batch {
+		size += len(e.data)
+	}
+	body := make([]byte, 0, size)
+	for _, e := range batch {
+		body = append(body, e.data...)
+	}
+	contentType := "application/x-ndjson"
+	if l.text {
+		contentType = "text/plain; charset=utf-8"
+	}
+	return l.batch.retry(func() error {
+		return l.http.post(body, contentType, true)
+	})
+}
+
+// Flush sends the queued records and waits until they are sent.
+func (l *HTTPLoggerItem) Flush() {
+	l.batch.flush()
+}
+
+// Close sends the queued records.
+func (l *HTTPLoggerItem) Close() {
+	l.batch.close()
+}
@@ -0,0 +1,146 @@
+package log4g
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collectorServer answers the requests with the codes of answers, with
+// the Retry-After retryAfter, then 204, and records when every request
+// arrived and the requests it accepts with their decoded bodies.
+type collectorServer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	answers    []int
+	retryAfter string
+	arrived    []time.Time
+	requests   []*http.Request
+	bodies     []string
+}
+
+func newCollectorServer(answers ...int) *collectorServer {
+	s := &collectorServer{answers: answers, retryAfter: "1"}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.arrived = append(s.arrived, time.Now())
+		if len(s.answers) > 0 {
+			code := s.answers[0]
+			s.answers = s.answers[1:]
+			w.Header().Set("Retry-After", s.retryAfter)
+			http.Error(w, "busy", code)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err == nil {
+				body, _ = ioutil.ReadAll(zr)
+			}
+		}
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return s
+}
+
+func TestHTTPItem(t *testing.T) {
+	s := newCollectorServer(http.StatusTooManyRequests)
+	defer s.Close()
+	l := itemLogger(t, "", `{"output": "http", "url": "`+s.URL+`", "batch_size": 2, "gzip": true,
+		"username": "app", "password": "pw", "headers": {"X-Team": "core"}, "json_ext": "{\"env\": \"test\"}"}`)
+	defer l.Close()
+
+	l.Warn("disk %s", "full", Fields{"user_id": 7})
+	l.Info("two")
+	l.Info("three")
+	l.Flush()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) != 2 {
+		t.Fatalf("%d requests accepted, want 2: %q", len(s.bodies), s.bodies)
+	}
+	r := s.requests[0]
+	user, password, _ := r.BasicAuth()
+	if r.Header.Get("Content-Type") != "application/x-ndjson" || r.Header.Get("Content-Encoding") != "gzip" ||
+		r.Header.Get("X-Team") != "core" || user != "app" || password != "pw" {
+		t.Errorf("request headers %v", r.Header)
+	}
+	// the batch refused with 429 is sent again whole
+	lines := strings.Split(strings.TrimSuffix(s.bodies[0], "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(s.bodies[1], `"message":"three"`) {
+		t.Fatalf("bodies %q", s.bodies)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["message"] != "disk full" || m["level"] != "WARN" || m["user_id"] != 7.0 || m["env"] != "test" || m["file"] != "item_http_test.go" {
+		t.Errorf("record %v", m)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, m["time"].(string)); err != nil {
+		t.Errorf("time %v: %v", m["time"], err)
+	}
+}
+
+func TestHTTPItemDropsRejected(t *testing.T) {
+	s := newCollectorServer(http.StatusBadRequest)
+	defer s.Close()
+	l := itemLogger(t, "", `{"output": "http", "url": "`+s.URL+`", "token": "t0ken", "codec": "plain"}`)
+	defer l.Close()
+
+	// a 400 is not retried
+	l.Info("rejected")
+	l.Flush()
+	l.Info("accepted")
+	l.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) != 1 || !strings.Contains(s.bodies[0], " INFO ") || !strings.HasSuffix(s.bodies[0], ": accepted\n") {
+		t.Fatalf("bodies %q", s.bodies)
+	}
+	r := s.requests[0]
+	if r.Header.Get("Authorization") != "Bearer t0ken" || !strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("request headers %v", r.Header)
+	}
+	if h := l.Health()[0]; !strings.Contains(h.LastError, "400 Bad Request: busy") {
+		t.Errorf("health %+v", h)
+	}
+}
+
+func TestHTTPItemCloseTimesOut(t *testing.T) {
+	block := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer s.Close()
+	defer close(block)
+	l := itemLogger(t, "", `{"output": "http", "url": "`+s.URL+`", "timeout": "100ms"}`)
+	l.Info("lost")
+
+	start := time.Now()
+	l.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %v", d)
+	}
+}
+
+func TestHTTPItemCodecs(t *testing.T) {
+	for codec, ok := range map[string]bool{"": true, "json": true, "plain": true, "text": false, "xml": false} {
+		l := itemLogger(t, "", `{"output": "http", "url": "http://127.0.0.1:1", "codec": "`+codec+`"}`)
+		if got := len(l.items) == 1; got != ok {
+			t.Errorf("codec %q accepted: %v", codec, got)
+		}
+		l.Close()
+	}
+}
@@ -0,0 +1,182 @@
+package log4g
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// newJournaldLoggerItem returns an item sending its records to journald at
+// the address of lc, /run/systemd/journal/socket by default.
+func newJournaldLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
+	item := new(JournaldLoggerItem)
+	item.address = lc.Address
+	if item.address == "" {
+		item.address = defaultJournalSocket
+	}
+	item.identifier = lc.AppName
+	if item.identifier == "" {
+		item.identifier = appName()
+	}
+	item.severities = newSeverities(lc.Severities)
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	return item
+}
+
+// JournaldLoggerItem writes each record as a datagram of journal fields:
+// MESSAGE, PRIORITY from the level as for syslog, SYSLOG_IDENTIFIER, the
+// CODE_FILE, CODE_LINE and CODE_FUNC of the caller, and the fields of the
+// record in upper case. A record too large for a datagram is passed in a
+// file.
+type JournaldLoggerItem struct {
+	*GenericLoggerItem
+	address    string
+	identifier string
+	severities severities
+	cmu        sync.Mutex // protects conn
+	conn       *net.UnixConn
+}
+
+// Write sends the text of a record written through a ref, at priority info.
+func (l *JournaldLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeRecord(&record{time: time.Now(), level: LEVEL_INFO, message: strings.TrimSuffix(string(p), "\n")})
+}
+
+func (l *JournaldLoggerItem) writeRecord(r *record) (n int, err error) {
+	buf := appendJournalField(nil, "MESSAGE", r.prefix+r.message)
+	buf = appendJournalField(buf, "PRIORITY", strconv.Itoa(l.severities.of(r.level)))
+	buf = appendJournalField(buf, "SYSLOG_IDENTIFIER", l.identifier)
+	if r.file != "" && r.file != "???" {
+		buf = appendJournalField(buf, "CODE_FILE", r.file)
+		buf = appendJournalField(buf, "CODE_LINE", strconv.Itoa(r.line))
+	}
+	if r.function != "" {
+		buf = appendJournalField(buf, "CODE_FUNC", r.function)
+	}
+	for _, k := range r.fields.keys() {
+		if name := journalFieldName(k); name != "" {
+			buf = appendJournalField(buf, name, fmt.Sprint(r.fields[k]))
+		}
+	}
+	if err = l.send(buf); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// appendJournalField appends the field key=value, in the binary form if
+// value spans several lines.
+func appendJournalField(buf []byte, key, value string) []byte {
+	buf = append(buf, key...)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf = append(buf, '=')
+	} else {
+		buf = append(buf, '\n')
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+		buf = append(buf, size[:]...)
+	}
+	buf = append(buf, value...)
+	return append(buf, '\n')
+}
+
+// journalReserved are the fields the item writes itself, or that journald
+// reads a meaning into. Fields of these names get a trailing underscore.
+var journalReserved = map[string]bool{
+	"MESSAGE":           true,
+	"MESSAGE_ID":        true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"SYSLOG_FACILITY":   true,
+	"SYSLOG_PID":        true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// journalFieldName returns key as a journal field name: upper case letters,
+// digits and underscores, not starting with an underscore, which marks the
+// fields set by journald, nor with a digit. It returns "" if nothing is left.
+func journalFieldName(key string) string {
+	b := make([]byte, 0, len(key))
+	for i := 0; i < len(key) && len(b) < 64; i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			c = '_'
+		}
+		if len(b) == 0 && (c == '_' || c >= '0' && c <= '9') {
+			continue
+		}
+		b = append(b, c)
+	}
+	if journalReserved[string(b)] {
+		return string(b) + "_"
+	}
+	return string(b)
+}
+
+// send writes the datagram p, connecting first if needed. The connection is
+// dropped on errors, so the next record connects again.
+func (l *JournaldLoggerItem) send(p []byte) error {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	if l.conn == nil {
+		if err := l.dial(); err != nil {
+			l.halt(err)
+			return errItemStopped
+		}
+	}
+	_, err := l.conn.Write(p)
+	if err != nil && tooLarge(err) {
+		err = sendJournalFile(l.conn, p)
+	}
+	if err != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+	return err
+}
+
+func (l *JournaldLoggerItem) dial() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: l.address, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	l.conn = conn
+	return nil
+}
+
+// Reopen connects to journald again, which resumes a stopped item.
+func (l *JournaldLoggerItem) Reopen() error {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+	if err := l.dial(); err != nil {
+		l.halt(err)
+		return err
+	}
+	l.resume()
+	return nil
+}
+
+func (l *JournaldLoggerItem) Close() {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
@@ -0,0 +1,141 @@
+//go:build !windows
+// +build !windows
+
+package log4g
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// listenJournal listens on a unixgram socket in dir standing for journald,
+// and returns a logger with a journald item sending to it.
+func listenJournal(t *testing.T, dir string) (*net.UnixConn, *Logger) {
+	sock := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, itemLogger(t, `"prefix": "[app] "`, `{"output": "journald", "address": "`+sock+`", "app_name": "app"}`)
+}
+
+// readJournal reads a datagram, or the file passed in its place, and
+// returns its fields.
+func readJournal(t *testing.T, conn *net.UnixConn) map[string]string {
+	buf := make([]byte, 1<<20)
+	oob := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "journal")
+		defer f.Close()
+		f.Seek(0, 0)
+		if data, err = ioutil.ReadAll(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatalf("bad field %q", data)
+		}
+		key := string(data[:i])
+		if data[i] == '=' {
+			end := bytes.IndexByte(data, '\n')
+			fields[key] = string(data[i+1 : end])
+			data = data[end+1:]
+		} else {
+			size := int(binary.LittleEndian.Uint64(data[i+1:]))
+			fields[key] = string(data[i+9 : i+9+size])
+			data = data[i+9+size+1:]
+		}
+	}
+	return fields
+}
+
+func TestJournald(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g-journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conn, l := listenJournal(t, dir)
+	defer conn.Close()
+	defer l.Close()
+
+	l.Warn("disk %s", "full", Fields{"user_id": 7, "_source": "x", "trace": "a\nb",
+		"message": "m", "priority": 1, "code_file": "f", "Message-ID": "id"})
+	fields := readJournal(t, conn)
+	want := map[string]string{
+		"MESSAGE":           "[app] disk full",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "app",
+		"CODE_FILE":         fields["CODE_FILE"],
+		"CODE_LINE":         fields["CODE_LINE"],
+		"CODE_FUNC":         "github.com/carsonsx/log4g.TestJournald",
+		"USER_ID":           "7",
+		"SOURCE":            "x",
+		"TRACE":             "a\nb",
+		"MESSAGE_":          "m",
+		"PRIORITY_":         "1",
+		"CODE_FILE_":        "f",
+		"MESSAGE_ID_":       "id",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %q, want %q", k, fields[k], v)
+		}
+	}
+	if len(fields) != len(want) {
+		t.Errorf("fields %v", fields)
+	}
+	if !strings.HasSuffix(fields["CODE_FILE"], "item_journald_test.go") {
+		t.Errorf("CODE_FILE = %q", fields["CODE_FILE"])
+	}
+	if _, err := strconv.Atoi(fields["CODE_LINE"]); err != nil {
+		t.Errorf("CODE_LINE = %q", fields["CODE_LINE"])
+	}
+}
+
+func TestJournaldLargeRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g-journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conn, l := listenJournal(t, dir)
+	defer conn.Close()
+	defer l.Close()
+
+	large := strings.Repeat("x", 4<<20)
+	l.Info(large)
+	fields := readJournal(t, conn)
+	if fields["MESSAGE"] != "[app] "+large {
+		t.Errorf("MESSAGE of %d bytes, want %d", len(fields["MESSAGE"]), len(large)+6)
+	}
+	if fields["PRIORITY"] != "6" {
+		t.Errorf("PRIORITY = %q", fields["PRIORITY"])
+	}
+}
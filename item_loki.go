@@ -0,0 +1,272 @@
+package log4g
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a stream idle that long is forgotten by the sender: Loki accepts its next
+// entries in any case
+const lokiStreamIdle = time.Hour
+
+// newLokiLoggerItem returns an item pushing batches of records to the Loki
+// push API at the url of lc.
+func newLokiLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
+	sender, err := newHTTPSender(lc)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	item := &LokiLoggerItem{
+		http:        sender,
+		labels:      make(map[string]string),
+		labelFields: lc.LabelFields,
+		protobuf:    lc.LokiFormat == "protobuf",
+		last:        make(map[string]time.Time),
+	}
+	for k, v := range lc.Labels {
+		item.labels[lokiLabelName(k)] = v
+	}
+	if len(item.labels) == 0 && len(item.labelFields) == 0 {
+		item.labels["app"] = appName()
+	}
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	item.batch = newBatcher(lc, item.GenericLoggerItem, item.sendBatch)
+	return item
+}
+
+// LokiLoggerItem pushes the records to Loki in streams labeled by static
+// labels and by some of their fields. Its records are queued and sent in
+// batches.
+type LokiLoggerItem struct {
+	*GenericLoggerItem
+	http        *httpSender
+	labels      map[string]string
+	labelFields []string
+	protobuf    bool
+	batch       *batcher
+	last        map[string]time.Time // of the last entry pushed to each stream, used by the sender only
+	swept       time.Time            // when the idle streams were last forgotten
+}
+
+func (l *LokiLoggerItem) monitor(m *itemMetrics, h *itemHealth) {
+	l.GenericLoggerItem.monitor(m, h)
+	l.batch.start()
+}
+
+// Write queues the text of a record written through a ref, at level info.
+func (l *LokiLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeRecord(&record{time: time.Now(), level: LEVEL_INFO, message: strings.TrimSuffix(string(p), "\n")})
+}
+
+// writeRecord queues the line of r in the stream of its labels. The line is
+// the level, the message and the fields that are not labels.
+func (l *LokiLoggerItem) writeRecord(r *record) (n int, err error) {
+	labels := make(map[string]string, len(l.labels)+len(l.labelFields))
+	for k, v := range l.labels {
+		labels[k] = v
+	}
+	fields := r.fields
+	for _, name := range l.labelFields {
+		if name == "level" {
+			labels["level"] = strings.ToLower(r.level.Name())
+			continue
+		}
+		v, ok := fields[name]
+		if !ok {
+			continue
+		}
+		labels[lokiLabelName(name)] = fmt.Sprint(v)
+		if len(fields) == len(r.fields) {
+			fields = make(Fields, len(r.fields))
+			for k, v := range r.fields {
+				fields[k] = v
+			}
+		}
+		delete(fields, name)
+	}
+	key, err := json.Marshal(labels)
+	if err != nil {
+		return 0, err
+	}
+	line := append([]byte(r.level.Name()), ' ')
+	line = appendMessage(line, r)
+	line = fields.appendText(line)
+	return l.batch.add(batchEntry{time: r.time, key: string(key), data: line})
+}
+
+// lokiLabelName returns name with the characters a label name may not hold
+// replaced by '_'.
+func lokiLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// lokiStream is a stream of a push request, with its entries in order.
+type lokiStream struct {
+	key     string
+	entries []batchEntry
+}
+
+// sendBatch pushes batch, with the entries of each stream sorted by time.
+// Loki rejects an entry older than the last one of its stream, so such an
+// entry takes the time of the last one.
+func (l *LokiLoggerItem) sendBatch(batch []batchEntry) error {
+	var streams []*lokiStream
+	byKey := make(map[string]*lokiStream)
+	for _, e := range batch {
+		s, ok := byKey[e.key]
+		if !ok {
+			s = &lokiStream{key: e.key}
+			byKey[e.key] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, e)
+	}
+	for _, s := range streams {
+		sort.SliceStable(s.entries, func(i, j int) bool {
+			return s.entries[i].time.Before(s.entries[j].time)
+		})
+		last := l.last[s.key]
+		for i := range s.entries {
+			if s.entries[i].time.Before(last) {
+				s.entries[i].time = last
+			}
+			last = s.entries[i].time
+		}
+		l.last[s.key] = last
+	}
+	l.forget(time.Now())
+	var body []byte
+	var err error
+	if l.protobuf {
+		body, err = lokiProtobuf(streams)
+	} else {
+		body, err = lokiJSON(streams)
+	}
+	if err != nil {
+		return err
+	}
+	return l.batch.retry(func() error {
+		if l.protobuf {
+			return l.http.post(body, "application/x-protobuf", false)
+		}
+		return l.http.post(body, "application/json", true)
+	})
+}
+
+// forget removes from last the streams idle for lokiStreamIdle, at most
+// once a minute.
+func (l *LokiLoggerItem) forget(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, t := range l.last {
+		if now.Sub(t) > lokiStreamIdle {
+			delete(l.last, key)
+		}
+	}
+}
+
+// lokiJSON returns the JSON push request of streams.
+func lokiJSON(streams []*lokiStream) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	req := struct {
+		Streams []stream `json:"streams"`
+	}{make([]stream, 0, len(streams))}
+	for _, s := range streams {
+		var js stream
+		if err := json.Unmarshal([]byte(s.key), &js.Stream); err != nil {
+			return nil, err
+		}
+		for _, e := range s.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), string(e.data)})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// lokiProtobuf returns the snappy compressed protobuf push request of
+// streams: a PushRequest of StreamAdapter messages, each with its labels
+// and EntryAdapter messages.
+func lokiProtobuf(streams []*lokiStream) ([]byte, error) {
+	var req []byte
+	for _, s := range streams {
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(s.key), &labels); err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		text := []byte{'{'}
+		for i, k := range names {
+			if i > 0 {
+				text = append(text, ", "...)
+			}
+			text = append(text, k...)
+			text = append(text, '=')
+			text = strconv.AppendQuote(text, labels[k])
+		}
+		text = append(text, '}')
+
+		stream := appendProtoBytes(nil, 1, text)
+		for _, e := range s.entries {
+			ts := appendProtoVarint(nil, 1, uint64(e.time.Unix()))
+			ts = appendProtoVarint(ts, 2, uint64(e.time.Nanosecond()))
+			entry := appendProtoBytes(nil, 1, ts)
+			entry = appendProtoBytes(entry, 2, e.data)
+			stream = appendProtoBytes(stream, 2, entry)
+		}
+		req = appendProtoBytes(req, 1, stream)
+	}
+	return snappyEncode(req), nil
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// appendProtoVarint appends the varint field number n of value v.
+func appendProtoVarint(buf []byte, n int, v uint64) []byte {
+	buf = appendVarint(buf, uint64(n)<<3)
+	return appendVarint(buf, v)
+}
+
+// appendProtoBytes appends the length delimited field number n of value p.
+func appendProtoBytes(buf []byte, n int, p []byte) []byte {
+	buf = appendVarint(buf, uint64(n)<<3|2)
+	buf = appendVarint(buf, uint64(len(p)))
+	return append(buf, p...)
+}
+
+// Flush sends the queued records and waits until they are sent.
+func (l *LokiLoggerItem) Flush() {
+	l.batch.flush()
+}
+
+// Close sends the queued records.
+func (l *LokiLoggerItem) Close() {
+	l.batch.close()
+}
@@ -0,0 +1,107 @@
+package log4g
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLokiForgetsIdleStreams(t *testing.T) {
+	now := time.Now()
+	l := &LokiLoggerItem{last: map[string]time.Time{
+		"idle":   now.Add(-2 * lokiStreamIdle),
+		"active": now.Add(-time.Second),
+	}}
+	l.forget(now)
+	if _, ok := l.last["idle"]; ok || len(l.last) != 1 {
+		t.Errorf("streams %v after forget", l.last)
+	}
+
+	// the streams are swept once a minute at most
+	l.last["idle"] = now.Add(-2 * lokiStreamIdle)
+	l.forget(now.Add(time.Second))
+	if len(l.last) != 2 {
+		t.Errorf("streams %v swept again within a minute", l.last)
+	}
+}
+
+// lokiPush is the JSON push request of a loki item.
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+func TestLokiPush(t *testing.T) {
+	s := newCollectorServer(http.StatusTooManyRequests)
+	s.retryAfter = "2"
+	defer s.Close()
+	l := itemLogger(t, "", `{"output": "loki", "url": "`+s.URL+`/loki/api/v1/push", "batch_wait": "1h",
+		"labels": {"job": "billing"}, "label_fields": ["level", "tenant"]}`)
+	defer l.Close()
+
+	// the batch refused with 429 is sent again after the Retry-After
+	l.Warn("disk full", Fields{"tenant": "a", "user_id": 7})
+	l.Info("ok")
+	l.Flush()
+	item := l.items[0].(*LokiLoggerItem)
+	first := item.last[`{"job":"billing","level":"warn","tenant":"a"}`]
+	// an entry older than the last of its stream takes its time
+	item.writeRecord(&record{time: first.Add(-time.Minute), level: LEVEL_WARN, message: "late", fields: Fields{"tenant": "a"}})
+	l.Flush()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) != 2 || len(s.arrived) != 3 {
+		t.Fatalf("%d requests, %d accepted: %q", len(s.arrived), len(s.bodies), s.bodies)
+	}
+	if d := s.arrived[1].Sub(s.arrived[0]); d < 2*time.Second {
+		t.Errorf("sent again after %v, before the Retry-After", d)
+	}
+	if ct := s.requests[0].Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q", ct)
+	}
+
+	var push lokiPush
+	if err := json.Unmarshal([]byte(s.bodies[0]), &push); err != nil {
+		t.Fatal(err)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("streams %+v", push.Streams)
+	}
+	want := []map[string]string{
+		{"job": "billing", "level": "warn", "tenant": "a"},
+		{"job": "billing", "level": "info"},
+	}
+	lines := []string{"WARN disk full user_id=7", "INFO ok"}
+	for i, stream := range push.Streams {
+		if len(stream.Stream) != len(want[i]) || len(stream.Values) != 1 {
+			t.Errorf("stream %d: %+v", i, stream)
+			continue
+		}
+		for k, v := range want[i] {
+			if stream.Stream[k] != v {
+				t.Errorf("stream %d: label %s = %q, want %q", i, k, stream.Stream[k], v)
+			}
+		}
+		if line := stream.Values[0][1]; !strings.HasPrefix(line, lines[i][:5]) || !strings.HasSuffix(line, lines[i][5:]) {
+			t.Errorf("stream %d: line %q, want %q", i, line, lines[i])
+		}
+	}
+	if ts := push.Streams[0].Values[0][0]; ts != strconv.FormatInt(first.UnixNano(), 10) {
+		t.Errorf("timestamp %s, want %d", ts, first.UnixNano())
+	}
+
+	push = lokiPush{}
+	if err := json.Unmarshal([]byte(s.bodies[1]), &push); err != nil {
+		t.Fatal(err)
+	}
+	if len(push.Streams) != 1 || len(push.Streams[0].Values) != 1 ||
+		push.Streams[0].Values[0][0] != strconv.FormatInt(first.UnixNano(), 10) || !strings.HasSuffix(push.Streams[0].Values[0][1], "late") {
+		t.Errorf("late entry not clamped: %+v", push.Streams)
+	}
+}
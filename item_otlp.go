@@ -0,0 +1,218 @@
+package log4g
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultOTLPURL = "http://localhost:4318/v1/logs"
+
+// the OpenTelemetry severity numbers of the built-in levels
+var otlpSeverities = []struct {
+	level  Level
+	number int
+}{
+	{LEVEL_PANIC, 24}, {LEVEL_FATAL, 21}, {LEVEL_ERROR, 17}, {LEVEL_WARN, 13},
+	{LEVEL_INFO, 9}, {LEVEL_DEBUG, 5}, {LEVEL_TRACE, 1},
+}
+
+// otlpSeverity maps a level to an OpenTelemetry severity number. A custom
+// level takes the range of the next less severe built-in level, with a
+// higher number the closer it is to the more severe one.
+func otlpSeverity(level Level) int {
+	for _, s := range otlpSeverities {
+		if level <= s.level {
+			n := s.number + int(s.level-level)*4/100
+			if n > s.number+3 {
+				n = s.number + 3
+			}
+			if n > 24 {
+				n = 24
+			}
+			return n
+		}
+	}
+	return 1
+}
+
+// newOTLPLoggerItem returns an item exporting batches of records to an
+// OpenTelemetry collector over OTLP/HTTP with JSON, at the url of lc or on
+// the local host.
+func newOTLPLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
+	if lc.URL == "" {
+		lc.URL = defaultOTLPURL
+	}
+	sender, err := newHTTPSender(lc)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	resource := map[string]string{"service.name": appName()}
+	if host, err := os.Hostname(); err == nil {
+		resource["host.name"] = host
+	}
+	for k, v := range lc.Resource {
+		resource[k] = v
+	}
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpAttribute(k, resource[k]))
+	}
+	item := &OTLPLoggerItem{http: sender}
+	item.resource, _ = json.Marshal(map[string]interface{}{"attributes": attrs})
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	item.batch = newBatcher(lc, item.GenericLoggerItem, item.sendBatch)
+	return item
+}
+
+// OTLPLoggerItem exports the records as OpenTelemetry log records. The
+// fields become attributes, except trace_id and span_id which set the trace
+// context of the record. Its records are queued and sent in batches.
+type OTLPLoggerItem struct {
+	*GenericLoggerItem
+	http     *httpSender
+	resource []byte // the JSON resource of the records
+	batch    *batcher
+}
+
+func (l *OTLPLoggerItem) monitor(m *itemMetrics, h *itemHealth) {
+	l.GenericLoggerItem.monitor(m, h)
+	l.batch.start()
+}
+
+// Write queues the text of a record written through a ref, at level info.
+func (l *OTLPLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeRecord(&record{time: time.Now(), level: LEVEL_INFO, message: strings.TrimSuffix(string(p), "\n")})
+}
+
+// writeRecord queues the JSON LogRecord of r.
+func (l *OTLPLoggerItem) writeRecord(r *record) (n int, err error) {
+	rec := map[string]interface{}{
+		"timeUnixNano":         strconv.FormatInt(r.time.UnixNano(), 10),
+		"observedTimeUnixNano": strconv.FormatInt(time.Now().UnixNano(), 10),
+		"severityNumber":       otlpSeverity(r.level),
+		"severityText":         r.level.Name(),
+		"body":                 map[string]interface{}{"stringValue": r.prefix + r.message},
+	}
+	attrs := make([]interface{}, 0, len(r.fields)+3)
+	if r.file != "" && r.file != "???" {
+		attrs = append(attrs, otlpAttribute("code.file.path", r.file), otlpAttribute("code.line.number", r.line))
+	}
+	if r.function != "" {
+		attrs = append(attrs, otlpAttribute("code.function.name", r.function))
+	}
+	for _, k := range r.fields.keys() {
+		v := r.fields[k]
+		if id, ok := otlpID(k, v); ok {
+			rec[id] = strings.ToLower(fmt.Sprint(v))
+			continue
+		}
+		attrs = append(attrs, otlpAttribute(k, v))
+	}
+	rec["attributes"] = attrs
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	return l.batch.add(batchEntry{time: r.time, data: data})
+}
+
+// otlpID returns the LogRecord key of the field k of value v if it is a
+// trace or span id in hex.
+func otlpID(k string, v interface{}) (string, bool) {
+	size := 0
+	switch k {
+	case "trace_id":
+		k, size = "traceId", 16
+	case "span_id":
+		k, size = "spanId", 8
+	default:
+		return "", false
+	}
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	if b, err := hex.DecodeString(s); err != nil || len(b) != size {
+		return "", false
+	}
+	return k, true
+}
+
+// otlpAttribute returns the JSON KeyValue of k and v.
+func otlpAttribute(k string, v interface{}) map[string]interface{} {
+	return map[string]interface{}{"key": k, "value": otlpValue(v)}
+}
+
+// otlpValue returns the JSON AnyValue of v, which is a string unless v is
+// a boolean, a number or a slice of them.
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		return map[string]interface{}{"intValue": fmt.Sprint(v)}
+	case uint64:
+		if v <= math.MaxInt64 {
+			return map[string]interface{}{"intValue": strconv.FormatUint(v, 10)}
+		}
+	case float32:
+		return otlpValue(float64(v))
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return map[string]interface{}{"doubleValue": v}
+		}
+	case []interface{}:
+		values := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			values = append(values, otlpValue(e))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case []string:
+		values := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			values = append(values, otlpValue(e))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
+
+// sendBatch exports batch as the log records of one resource and scope.
+func (l *OTLPLoggerItem) sendBatch(batch []batchEntry) error {
+	body := append([]byte(`{"resourceLogs":[{"resource":`), l.resource...)
+	body = append(body, `,"scopeLogs":[{"scope":{"name":"github.com/carsonsx/log4g"},"logRecords":[`...)
+	for i, e := range batch {
+		if i > 0 {
+			body = append(body, ',')
+		}
+		body = append(body, e.data...)
+	}
+	body = append(body, "]}]}]}"...)
+	return l.batch.retry(func() error {
+		return l.http.post(body, "application/json", true)
+	})
+}
+
+// Flush sends the queued records and waits until they are sent.
+func (l *OTLPLoggerItem) Flush() {
+	l.batch.flush()
+}
+
+// Close sends the queued records.
+func (l *OTLPLoggerItem) Close() {
+	l.batch.close()
+}
@@ -0,0 +1,166 @@
+package log4g
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// otlpCollector is an httptest collector keeping the export requests it
+// accepts, and answering the first fail requests with 503.
+type otlpCollector struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []map[string]interface{}
+	headers  []http.Header
+	fail     int
+}
+
+func newOTLPCollector(t *testing.T) *otlpCollector {
+	c := new(otlpCollector)
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if r.URL.Path != "/v1/logs" || r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		if c.fail > 0 {
+			c.fail--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		c.requests = append(c.requests, req)
+		c.headers = append(c.headers, r.Header)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	return c
+}
+
+// otlpAttributes returns the attributes of an OTLP JSON object by key.
+func otlpAttributes(obj interface{}) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	list, _ := obj.(map[string]interface{})["attributes"].([]interface{})
+	for _, a := range list {
+		kv := a.(map[string]interface{})
+		for _, v := range kv["value"].(map[string]interface{}) {
+			attrs[kv["key"].(string)] = v
+		}
+	}
+	return attrs
+}
+
+func TestOTLPExport(t *testing.T) {
+	c := newOTLPCollector(t)
+	defer c.Close()
+	l := itemLogger(t, `"prefix": "[billing] "`, `{"output":"otlp","url":"`+c.URL+`/v1/logs","token":"secret","batch_wait":"1h",
+		"resource":{"service.name":"billing","deployment.environment":"prod"}}`)
+	defer l.Close()
+
+	l.Warn("charge %d failed", 42, Fields{
+		"user_id":  7,
+		"ratio":    0.5,
+		"retry":    true,
+		"trace_id": "4BF92F3577B34DA6A3CE929D0E0E4736",
+		"span_id":  "00f067aa0ba902b7",
+	})
+	l.Info("done")
+	l.Flush()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) != 1 {
+		t.Fatalf("%d requests", len(c.requests))
+	}
+	if h := c.headers[0].Get("Authorization"); h != "Bearer secret" {
+		t.Errorf("Authorization = %q", h)
+	}
+	rl := c.requests[0]["resourceLogs"].([]interface{})[0].(map[string]interface{})
+	resource := otlpAttributes(rl["resource"])
+	host, _ := os.Hostname()
+	for k, v := range map[string]interface{}{"service.name": "billing", "host.name": host, "deployment.environment": "prod"} {
+		if resource[k] != v {
+			t.Errorf("resource %s = %v, want %v", k, resource[k], v)
+		}
+	}
+	records := rl["scopeLogs"].([]interface{})[0].(map[string]interface{})["logRecords"].([]interface{})
+	if len(records) != 2 {
+		t.Fatalf("%d records", len(records))
+	}
+	rec := records[0].(map[string]interface{})
+	want := map[string]interface{}{
+		"severityNumber": 13.0,
+		"severityText":   "WARN",
+		"traceId":        "4bf92f3577b34da6a3ce929d0e0e4736",
+		"spanId":         "00f067aa0ba902b7",
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s = %v, want %v", k, rec[k], v)
+		}
+	}
+	if body := rec["body"].(map[string]interface{})["stringValue"]; body != "[billing] charge 42 failed" {
+		t.Errorf("body = %v", body)
+	}
+	if rec["timeUnixNano"] == nil {
+		t.Error("no timeUnixNano")
+	}
+	attrs := otlpAttributes(rec)
+	wantAttrs := map[string]interface{}{
+		"user_id":            "7",
+		"ratio":              0.5,
+		"retry":              true,
+		"code.function.name": "github.com/carsonsx/log4g.TestOTLPExport",
+	}
+	for k, v := range wantAttrs {
+		if attrs[k] != v {
+			t.Errorf("attribute %s = %v, want %v", k, attrs[k], v)
+		}
+	}
+	if _, ok := attrs["trace_id"]; ok {
+		t.Error("trace_id left in the attributes")
+	}
+	if filepath.Base(attrs["code.file.path"].(string)) != "item_otlp_test.go" {
+		t.Errorf("code.file.path = %v", attrs["code.file.path"])
+	}
+	if rec := records[1].(map[string]interface{}); rec["severityNumber"] != 9.0 || rec["traceId"] != nil {
+		t.Errorf("record %v", rec)
+	}
+}
+
+func TestOTLPRetry(t *testing.T) {
+	c := newOTLPCollector(t)
+	defer c.Close()
+	c.fail = 1
+	l := itemLogger(t, `"prefix": "[billing] "`, `{"output":"otlp","url":"`+c.URL+`/v1/logs"}`)
+	defer l.Close()
+
+	l.Error("once")
+	l.Flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) != 1 {
+		t.Fatalf("%d requests", len(c.requests))
+	}
+}
+
+func TestOTLPSeverity(t *testing.T) {
+	for level, want := range map[Level]int{
+		LEVEL_PANIC: 24, LEVEL_FATAL: 21, LEVEL_ERROR: 17, LEVEL_WARN: 13,
+		LEVEL_INFO: 9, LEVEL_DEBUG: 5, LEVEL_TRACE: 1,
+		450: 11, 150: 23, 800: 1,
+	} {
+		if n := otlpSeverity(level); n != want {
+			t.Errorf("otlpSeverity(%d) = %d, want %d", level, n, want)
+		}
+	}
+}
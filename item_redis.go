@@ -2,6 +2,8 @@ package log4g
 
 import (
 	"encoding/json"
+	"log"
+
 	"github.com/go-redis/redis"
 )
 
@@ -14,6 +16,11 @@ func newRedisLoggerItem(level Level, prefix string, flag int, lc *loggerConfig,
 	})
 	redisLogger.lc = lc
 	redisLogger.GenericLoggerItem = newLoggerItem(level, prefix, flag, redisLogger, calldepth)
+	spool, err := newSpool(lc, redisLogger.GenericLoggerItem, redisLogger.send)
+	if err != nil {
+		log.Printf("log4g: spool %s: %v", lc.Spool, err)
+	}
+	redisLogger.spool = spool
 	return redisLogger
 }
 
@@ -43,12 +50,20 @@ func (l *RedisLoggerItem) Write(p []byte) (n int, err error) {
 	}
 
 	if l.lc.RedisType == "list" {
+		if l.spool != nil {
+			return l.spool.write(p, l.send)
+		}
 		cmd := l.cli.RPush(l.lc.RedisKey, p)
 		return int(cmd.Val()), cmd.Err()
 	}
 	return 0, nil
 }
 
+func (l *RedisLoggerItem) send(p []byte) error {
+	return l.cli.RPush(l.lc.RedisKey, p).Err()
+}
+
 func (l *RedisLoggerItem) Close() {
+	l.spool.close()
 	l.cli.Close()
 }
@@ -0,0 +1,29 @@
+package log4g
+
+import "io"
+
+// newRefLoggerItem returns an item with its own level, prefix and flag that
+// writes through the output of target, an item owned by another logger.
+func newRefLoggerItem(level Level, prefix string, flag int, target LoggerItem, calldepth int) LoggerItem {
+	w, ok := target.(interface {
+		writer() io.Writer
+	})
+	if !ok {
+		return nil
+	}
+	item := new(RefLoggerItem)
+	item.target = target
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, w.writer(), calldepth)
+	return item
+}
+
+// RefLoggerItem shares the output of an item declared by another logger.
+// The owner of the output closes it; Close here is a no-op.
+type RefLoggerItem struct {
+	*GenericLoggerItem
+	target LoggerItem
+}
+
+func (l *RefLoggerItem) Flush() {
+	l.target.Flush()
+}
@@ -1,38 +1,127 @@
 package log4g
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	defaultSocketTimeout = 5 * time.Second
+	defaultResolve       = time.Minute
+)
+
+var errNotConnected = errors.New("log4g: socket not connected")
+
+// newSocketLoggerItem returns an item sending to the address, or addresses,
+// of lc. It connects in the background once it is monitored.
 func newSocketLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
-	socketLogger := new(SocketLoggerItem)
-	var err error
+	if lc.Codec == "gelf" {
+		return newGelfLoggerItem(level, prefix, flag, lc, calldepth)
+	}
 	if lc.Network == "" {
 		lc.Network = "udp"
 	}
-	socketLogger.conn, err = net.Dial(lc.Network, lc.Address)
-	if err != nil {
-		fmt.Println(err)
-		return nil
-	}
-	socketLogger.lc = lc
+	socketLogger := newSocket(lc)
 	socketLogger.GenericLoggerItem = newLoggerItem(level, prefix, flag, socketLogger, calldepth)
+	socketLogger.init()
+	return socketLogger
+}
+
+// newSocket returns the transport of a socket item, for items that encode
+// the records their own way. init must be called once the item has its
+// GenericLoggerItem.
+func newSocket(lc *loggerConfig) *SocketLoggerItem {
+	socketLogger := new(SocketLoggerItem)
+	socketLogger.lc = lc
+	socketLogger.roundRobin = lc.Balance == "round_robin"
+	socketLogger.dialTimeout = configDuration("dial_timeout", lc.DialTimeout, defaultSocketTimeout)
+	socketLogger.writeTimeout = configDuration("write_timeout", lc.WriteTimeout, defaultSocketTimeout)
+	socketLogger.resolveEvery = configDuration("resolve", lc.Resolve, defaultResolve)
+	addresses := lc.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{lc.Address}
+	}
+	for _, address := range addresses {
+		socketLogger.endpoints = append(socketLogger.endpoints, &endpoint{address: address})
+	}
+	socketLogger.wake = make(chan struct{}, 1)
+	socketLogger.stop = make(chan struct{})
+	socketLogger.done = make(chan struct{})
 	return socketLogger
 }
 
+// init loads the TLS files and opens the spool, if configured.
+func (l *SocketLoggerItem) init() {
+	if l.lc.Network == "tls" {
+		var err error
+		if l.tls, err = tlsConfig(l.lc); err != nil {
+			l.halt(err)
+		}
+	}
+	spool, err := newSpool(l.lc, l.GenericLoggerItem, l.send)
+	if err != nil {
+		log.Printf("log4g: spool %s: %v", l.lc.Spool, err)
+	}
+	l.spool = spool
+}
+
+// SocketLoggerItem sends each record to one of its endpoints: the first
+// that is connected, or the next one in turn with round_robin. A connector
+// goroutine dials the endpoints and resolves their hosts again, so a record
+// never waits for a dial: while no endpoint is connected, including before
+// the first dial is over, the item drops its records or spools them. An endpoint whose dial fails is retried
+// after a growing delay.
 type SocketLoggerItem struct {
 	*GenericLoggerItem
-	conn net.Conn
-	lc   *loggerConfig
+	lc           *loggerConfig
+	roundRobin   bool
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	resolveEvery time.Duration
+	split        func(p []byte) [][]byte             // splits a record into datagrams
+	ack          func(conn net.Conn, p []byte) error // reads the reply to p
+	reconnect    int32                               // 1 to dial every endpoint again, accessed atomically
+	wake         chan struct{}                       // wakes the connector
+	stop         chan struct{}
+	done         chan struct{}
+	started      bool
+	cmu          sync.Mutex  // protects the connections of the endpoints and the following fields
+	tls          *tls.Config // of the "tls" network
+	endpoints    []*endpoint
+	next         int
 }
 
-func (l *SocketLoggerItem) Write(p []byte) (n int, err error) {
+// endpoint is one address of a socket item with its connection. Only the
+// connector uses the fields after gone.
+type endpoint struct {
+	address  string
+	conn     net.Conn
+	gone     *int32   // set atomically once the peer closed conn
+	ips      []string // the addresses the host resolved to
+	resolved time.Time
+	backoff  time.Duration
+	retryAt  time.Time
+}
 
-	if l.conn == nil {
-		return
+func (l *SocketLoggerItem) monitor(m *itemMetrics, h *itemHealth) {
+	l.GenericLoggerItem.monitor(m, h)
+	if !l.started {
+		l.started = true
+		go l.run()
 	}
+}
+
+func (l *SocketLoggerItem) Write(p []byte) (n int, err error) {
 
 	if p[len(p)-1] == '\n' {
 		p = p[0 : len(p)-1]
@@ -51,15 +140,344 @@ func (l *SocketLoggerItem) Write(p []byte) (n int, err error) {
 		p, _ = json.Marshal(rec)
 	}
 
-	if l.lc.Network == "tcp" {
+	if l.stream() {
 		p = append(p, '\n')
 	}
 
-	return l.conn.Write(p)
+	return l.deliver(p)
+}
+
+// stream reports whether the network of l carries a stream of bytes, so
+// that the records need framing.
+func (l *SocketLoggerItem) stream() bool {
+	switch l.lc.Network {
+	case "tcp", "tcp4", "tcp6", "tls", "unix":
+		return true
+	}
+	return false
+}
+
+// deliver sends the framed record p, through the spool if there is one.
+func (l *SocketLoggerItem) deliver(p []byte) (n int, err error) {
+	if l.spool != nil {
+		return l.spool.write(p, l.send)
+	}
+	if err = l.send(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send writes p to a connected endpoint, trying the others if it fails.
+func (l *SocketLoggerItem) send(p []byte) error {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	start := 0
+	if l.roundRobin {
+		start = l.next
+		l.next = (l.next + 1) % len(l.endpoints)
+	}
+	var err error
+	for i := range l.endpoints {
+		e := l.endpoints[(start+i)%len(l.endpoints)]
+		if !e.connected() {
+			continue
+		}
+		if err = l.sendTo(e, p); err == nil {
+			return nil
+		}
+		e.close()
+		l.kick()
+	}
+	if err != nil {
+		return err
+	}
+	if l.spool != nil {
+		return errNotConnected
+	}
+	return errItemStopped
+}
+
+// sendTo writes p to the connection of e, and reads the reply if the item
+// expects one.
+func (l *SocketLoggerItem) sendTo(e *endpoint, p []byte) error {
+	e.conn.SetWriteDeadline(time.Now().Add(l.writeTimeout))
+	err := l.write(e.conn, p)
+	if err == nil && l.ack != nil {
+		e.conn.SetReadDeadline(time.Now().Add(l.writeTimeout))
+		err = l.ack(e.conn, p)
+	}
+	return err
+}
+
+// write writes p to conn, in the datagrams split returns if it is set.
+func (l *SocketLoggerItem) write(conn net.Conn, p []byte) error {
+	if l.split == nil {
+		_, err := conn.Write(p)
+		return err
+	}
+	for _, d := range l.split(p) {
+		if _, err := conn.Write(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kick wakes the connector.
+func (l *SocketLoggerItem) kick() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run is the connector. It connects the endpoints, then again whenever one
+// is lost, Reopen is called, a retry is due or a host must be resolved
+// again.
+func (l *SocketLoggerItem) run() {
+	defer close(l.done)
+	wait := l.connect(false)
+	for {
+		t := time.NewTimer(wait)
+		select {
+		case <-l.stop:
+			t.Stop()
+			return
+		case <-l.wake:
+			t.Stop()
+		case <-t.C:
+		}
+		wait = l.connect(atomic.SwapInt32(&l.reconnect, 0) != 0)
+	}
+}
+
+// connect dials the endpoints that are not connected and due, all of them
+// with round_robin and otherwise those before the first connected, and
+// replaces the connections to an address the host no longer resolves to.
+// With reconnect every endpoint is dialed again. It resumes or stops the
+// item, and returns how long to wait until the next attempt is due.
+func (l *SocketLoggerItem) connect(reconnect bool) time.Duration {
+	l.cmu.Lock()
+	noTLS := l.lc.Network == "tls" && l.tls == nil
+	l.cmu.Unlock()
+	if noTLS {
+		// stopped until Reopen reads the TLS files
+		return maxRetry
+	}
+	now := time.Now()
+	next := now.Add(l.resolveEvery)
+	var err error
+	up := false
+	for _, e := range l.endpoints {
+		if up && !l.roundRobin {
+			l.cmu.Lock()
+			e.close()
+			l.cmu.Unlock()
+			continue
+		}
+		l.cmu.Lock()
+		conn, connected := e.conn, e.connected()
+		l.cmu.Unlock()
+		if connected && !reconnect && (now.Sub(e.resolved) < l.resolveEvery || !l.moved(e, conn)) {
+			up = true
+			continue
+		}
+		if !connected && !reconnect && now.Before(e.retryAt) {
+			if e.retryAt.Before(next) {
+				next = e.retryAt
+			}
+			continue
+		}
+		if conn, err = l.dial(e); err != nil {
+			if e.backoff *= 2; e.backoff < minRetry {
+				e.backoff = minRetry
+			} else if e.backoff > maxRetry {
+				e.backoff = maxRetry
+			}
+			e.retryAt = now.Add(jitter(e.backoff))
+			if e.retryAt.Before(next) {
+				next = e.retryAt
+			}
+			continue
+		}
+		e.backoff = 0
+		l.attach(e, conn)
+		up = true
+	}
+	if !up {
+		if err == nil {
+			err = errNotConnected
+		}
+		l.halt(err)
+	} else {
+		if err != nil {
+			l.health.fail(err)
+		}
+		if l.stopped() {
+			l.resume()
+		}
+		l.spool.notify()
+	}
+	return next.Sub(now)
+}
+
+// attach makes conn the connection of e, closing the previous one. Unless
+// the item reads replies, the connection is read so that a peer closing it
+// wakes the connector.
+func (l *SocketLoggerItem) attach(e *endpoint, conn net.Conn) {
+	gone := new(int32)
+	l.cmu.Lock()
+	e.close()
+	e.conn = conn
+	e.gone = gone
+	l.cmu.Unlock()
+	if l.stream() && l.ack == nil {
+		// collectors do not answer, so a read only ends when the peer
+		// closes the connection, or when we do
+		go func() {
+			io.Copy(ioutil.Discard, conn)
+			atomic.StoreInt32(gone, 1)
+			l.kick()
+		}()
+	}
+}
+
+// resolve looks up the host of e, keeping the last addresses if the lookup
+// fails. Unix sockets and IP addresses are not looked up.
+func (l *SocketLoggerItem) resolve(e *endpoint) error {
+	e.resolved = time.Now()
+	if strings.HasPrefix(l.lc.Network, "unix") {
+		e.ips = []string{e.address}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(e.address)
+	if err != nil {
+		return err
+	}
+	if net.ParseIP(host) != nil {
+		e.ips = []string{host}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.dialTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		if len(e.ips) > 0 {
+			l.health.fail(err)
+			return nil
+		}
+		return err
+	}
+	e.ips = ips
+	return nil
+}
+
+// moved resolves the host of e again and reports whether conn is to an
+// address the host no longer resolves to.
+func (l *SocketLoggerItem) moved(e *endpoint, conn net.Conn) bool {
+	if l.resolve(e) != nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+	for _, ip := range e.ips {
+		if ip == host {
+			return false
+		}
+	}
+	return true
+}
+
+// dial connects to the first of the addresses of the host of e that
+// answers.
+func (l *SocketLoggerItem) dial(e *endpoint) (net.Conn, error) {
+	if len(e.ips) == 0 || time.Since(e.resolved) >= l.resolveEvery {
+		if err := l.resolve(e); err != nil {
+			return nil, err
+		}
+	}
+	d := net.Dialer{Timeout: l.dialTimeout}
+	var err error
+	for _, ip := range e.ips {
+		address := ip
+		if !strings.HasPrefix(l.lc.Network, "unix") {
+			_, port, _ := net.SplitHostPort(e.address)
+			address = net.JoinHostPort(ip, port)
+		}
+		var conn net.Conn
+		if l.lc.Network == "tls" {
+			conn, err = l.dialTLS(&d, e, address)
+		} else {
+			conn, err = d.Dial(l.lc.Network, address)
+		}
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// dialTLS connects to address over TCP and completes the handshake within
+// the dial timeout, checking the certificate against the host of e unless a
+// server name is configured.
+func (l *SocketLoggerItem) dialTLS(d *net.Dialer, e *endpoint, address string) (net.Conn, error) {
+	l.cmu.Lock()
+	c := l.tls
+	l.cmu.Unlock()
+	if c == nil {
+		return nil, errNotConnected
+	}
+	if c.ServerName == "" {
+		c = c.Clone()
+		c.ServerName, _, _ = net.SplitHostPort(e.address)
+	}
+	td := tls.Dialer{NetDialer: d, Config: c}
+	return td.Dial("tcp", address)
+}
+
+func (e *endpoint) connected() bool {
+	return e.conn != nil && atomic.LoadInt32(e.gone) == 0
+}
+
+func (e *endpoint) close() {
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
+
+// Reopen reads the TLS files again and has the connector dial every
+// endpoint again, without waiting for the delay of the failed ones. The
+// current connections are used until they are replaced, and the item
+// resumes once an endpoint answers.
+func (l *SocketLoggerItem) Reopen() error {
+	if l.lc.Network == "tls" {
+		c, err := tlsConfig(l.lc)
+		if err != nil {
+			l.halt(err)
+			return err
+		}
+		l.cmu.Lock()
+		l.tls = c
+		l.cmu.Unlock()
+	}
+	atomic.StoreInt32(&l.reconnect, 1)
+	l.kick()
+	return nil
 }
 
 func (l *SocketLoggerItem) Close() {
-	if l.conn != nil {
-		l.conn.Close()
+	l.spool.close()
+	if l.started {
+		close(l.stop)
+		<-l.done
+	}
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	for _, e := range l.endpoints {
+		e.close()
 	}
 }
@@ -0,0 +1,191 @@
+package log4g
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitStatus waits until the health of the first item of l is status, or
+// is not stopped if status is empty.
+func waitStatus(t *testing.T, l *Logger, status string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		h := l.Health()[0]
+		if h.Status == status || status == "" && h.Status != "stopped" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("health %+v, want %q", h, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitConnected waits until the socket item first in l has a connected
+// endpoint, as the records logged before are dropped.
+func waitConnected(t *testing.T, l *Logger) {
+	var s *SocketLoggerItem
+	switch item := l.items[0].(type) {
+	case *SocketLoggerItem:
+		s = item
+	case *GelfLoggerItem:
+		s = item.SocketLoggerItem
+	case *SyslogLoggerItem:
+		s = item.SocketLoggerItem
+	case *FluentLoggerItem:
+		s = item.SocketLoggerItem
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s.cmu.Lock()
+		connected := false
+		for _, e := range s.endpoints {
+			connected = connected || e.connected()
+		}
+		s.cmu.Unlock()
+		if connected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not connected: %+v", l.Health()[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// lineServer listens on address, or a free port if it is empty, and returns
+// the lines it receives and the connections it accepts.
+func lineServer(t *testing.T, address string) (net.Listener, chan string, chan net.Conn) {
+	if address == "" {
+		address = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string, 100)
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					lines <- sc.Text()
+				}
+			}()
+		}
+	}()
+	return ln, lines, conns
+}
+
+func receive(t *testing.T, lines chan string, want string) {
+	select {
+	case line := <-lines:
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("%q not received", want)
+	}
+}
+
+func TestSocketReconnect(t *testing.T) {
+	ln, lines, conns := lineServer(t, "")
+	address := ln.Addr().String()
+	l := itemLogger(t, `"flag": ""`, `{"output": "socket", "network": "tcp", "address": "`+address+`", "dial_timeout": "1s"}`)
+	defer l.Close()
+	waitConnected(t, l)
+	l.Info("one")
+	receive(t, lines, " INFO one")
+
+	// a connection the peer closes is dialed again in the background
+	(<-conns).Close()
+	conn := <-conns
+	l.Info("two")
+	receive(t, lines, " INFO two")
+
+	// records are dropped at once while no endpoint answers
+	ln.Close()
+	conn.Close()
+	waitStatus(t, l, "stopped")
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		l.Info("dropped")
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("logging while disconnected took %v", d)
+	}
+
+	// Reopen returns at once and the item resumes once connected
+	ln, lines, _ = lineServer(t, address)
+	defer ln.Close()
+	start = time.Now()
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Reopen took %v", d)
+	}
+	waitStatus(t, l, "")
+	l.Info("three")
+	receive(t, lines, " INFO three")
+}
+
+func TestSocketSpool(t *testing.T) {
+	ln, _, _ := lineServer(t, "")
+	address := ln.Addr().String()
+	ln.Close()
+	spool, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(spool)
+	l := itemLogger(t, `"flag": ""`, `{"output": "socket", "network": "tcp", "address": "`+address+`",
+		"spool": "`+filepath.ToSlash(spool)+`"}`)
+	defer l.Close()
+	l.Info("a")
+	l.Info("b")
+
+	// the spool replays in order once the connector reconnects
+	ln, lines, _ := lineServer(t, address)
+	defer ln.Close()
+	l.Reopen()
+	receive(t, lines, " INFO a")
+	receive(t, lines, " INFO b")
+	l.Info("c")
+	receive(t, lines, " INFO c")
+}
+
+func TestSocketFirstRecordDoesNotWait(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tlsLn, _ := testPKI(t, dir)
+	tlsLn.Close()
+	// a peer accepting connections but never answering the handshake
+	ln, _, conns := lineServer(t, "")
+	defer ln.Close()
+	l := newTLSLogger(t, dir, ln.Addr().String(), filepath.Join(dir, "ca.crt"))
+	l.SetErrorHandler(func(item string, err error) {})
+	conn := <-conns
+
+	start := time.Now()
+	l.Info("dropped")
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("first record took %v", d)
+	}
+	conn.Close()
+	l.Close()
+}
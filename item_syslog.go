@@ -0,0 +1,237 @@
+package log4g
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultSyslogAddress = "/dev/log"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// severity maps a level to a syslog severity. A custom level takes the
+// severity of the built-in levels around it, and one between WARN and INFO
+// is a notice.
+func severity(level Level) int {
+	switch {
+	case level <= LEVEL_PANIC:
+		return 0
+	case level <= LEVEL_FATAL:
+		return 2
+	case level <= LEVEL_ERROR:
+		return 3
+	case level <= LEVEL_WARN:
+		return 4
+	case level < LEVEL_INFO:
+		return 5
+	case level < LEVEL_DEBUG:
+		return 6
+	}
+	return 7
+}
+
+// severities maps some levels to syslog severities, the others following
+// severity.
+type severities map[Level]int
+
+// newSeverities parses the severities of the levels named in m.
+func newSeverities(m map[string]string) severities {
+	s := make(severities)
+	for name, sev := range m {
+		level, ok := lookupLevel(name)
+		n, ok2 := syslogSeverities[strings.ToLower(sev)]
+		if !ok || !ok2 {
+			log.Printf("log4g: invalid severity %s for %s", sev, name)
+			continue
+		}
+		s[level] = n
+	}
+	return s
+}
+
+func (s severities) of(level Level) int {
+	if n, ok := s[level]; ok {
+		return n
+	}
+	return severity(level)
+}
+
+// newSyslogLoggerItem returns an item sending RFC 5424, or RFC 3164, messages
+// to the syslog daemon at /dev/log, or to the address of lc. Records on a
+// stream are framed by octet counting (RFC 6587).
+func newSyslogLoggerItem(level Level, prefix string, flag int, lc *loggerConfig, calldepth int) LoggerItem {
+	if lc.Address == "" && len(lc.Addresses) == 0 {
+		lc.Address = defaultSyslogAddress
+		if lc.Network == "" {
+			lc.Network = "unixgram"
+		}
+	}
+	if lc.Network == "" {
+		lc.Network = "udp"
+	}
+	item := &SyslogLoggerItem{SocketLoggerItem: newSocket(lc)}
+	item.GenericLoggerItem = newLoggerItem(level, prefix, flag, item, calldepth)
+	item.init()
+
+	item.rfc3164 = lc.SyslogFormat == "rfc3164"
+	item.facility = syslogFacilities["user"]
+	if lc.Facility != "" {
+		if f, ok := syslogFacilities[strings.ToLower(lc.Facility)]; ok {
+			item.facility = f
+		} else {
+			log.Printf("log4g: invalid facility %s", lc.Facility)
+		}
+	}
+	item.severities = newSeverities(lc.Severities)
+	item.hostname, _ = os.Hostname()
+	item.appName = syslogName(lc.AppName, appName(), 48)
+	item.procID = syslogName(lc.ProcID, strconv.Itoa(os.Getpid()), 128)
+	item.msgID = syslogName(lc.MsgID, "-", 32)
+	item.sdID = syslogName(lc.SDID, "fields@32473", 32)
+	return item
+}
+
+// SyslogLoggerItem writes to a syslog daemon or collector over the socket
+// transport, so it reconnects, balances and spools like a socket item.
+type SyslogLoggerItem struct {
+	*SocketLoggerItem
+	rfc3164    bool
+	facility   int
+	severities severities
+	hostname   string
+	appName    string
+	procID     string
+	msgID      string
+	sdID       string
+}
+
+// Write sends the text of a record written through a ref, at severity info.
+func (l *SyslogLoggerItem) Write(p []byte) (n int, err error) {
+	return l.writeRecord(&record{time: time.Now(), level: LEVEL_INFO, message: strings.TrimSuffix(string(p), "\n")})
+}
+
+func (l *SyslogLoggerItem) writeRecord(r *record) (n int, err error) {
+	pri := l.facility*8 + l.severities.of(r.level)
+	var msg []byte
+	if l.rfc3164 {
+		msg = l.format3164(msg, pri, r)
+	} else {
+		msg = l.format5424(msg, pri, r)
+	}
+	if l.stream() {
+		framed := strconv.AppendInt(nil, int64(len(msg)), 10)
+		framed = append(framed, ' ')
+		msg = append(framed, msg...)
+	}
+	return l.deliver(msg)
+}
+
+// format5424 appends the RFC 5424 message of r, with its fields as the
+// structured data.
+func (l *SyslogLoggerItem) format5424(buf []byte, pri int, r *record) []byte {
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(pri), 10)
+	buf = append(buf, ">1 "...)
+	buf = r.time.AppendFormat(buf, "2006-01-02T15:04:05.000000Z07:00")
+	buf = append(buf, ' ')
+	buf = append(buf, syslogName(l.hostname, "-", 255)...)
+	buf = append(buf, ' ')
+	buf = append(buf, l.appName...)
+	buf = append(buf, ' ')
+	buf = append(buf, l.procID...)
+	buf = append(buf, ' ')
+	buf = append(buf, l.msgID...)
+	buf = append(buf, ' ')
+	if len(r.fields) == 0 {
+		buf = append(buf, '-')
+	} else {
+		buf = append(buf, '[')
+		buf = append(buf, l.sdID...)
+		for _, k := range r.fields.keys() {
+			buf = append(buf, ' ')
+			buf = append(buf, syslogName(k, "_", 32)...)
+			buf = append(buf, `="`...)
+			buf = appendSDValue(buf, fmt.Sprint(r.fields[k]))
+			buf = append(buf, '"')
+		}
+		buf = append(buf, ']')
+	}
+	buf = append(buf, ' ')
+	return appendMessage(buf, r)
+}
+
+// format3164 appends the BSD syslog message of r, with its fields appended
+// to the message as key=value.
+func (l *SyslogLoggerItem) format3164(buf []byte, pri int, r *record) []byte {
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(pri), 10)
+	buf = append(buf, '>')
+	buf = r.time.AppendFormat(buf, time.Stamp)
+	buf = append(buf, ' ')
+	if l.hostname != "" {
+		buf = append(buf, l.hostname...)
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, l.appName...)
+	buf = append(buf, '[')
+	buf = append(buf, l.procID...)
+	buf = append(buf, "]: "...)
+	buf = appendMessage(buf, r)
+	return r.fields.appendText(buf)
+}
+
+// appendMessage appends the prefix, the caller if the flag asks for it,
+// and the message of r.
+func appendMessage(buf []byte, r *record) []byte {
+	buf = append(buf, r.prefix...)
+	if caller := r.caller(); caller != "" {
+		buf = append(buf, caller...)
+		buf = append(buf, ": "...)
+	}
+	return append(buf, r.message...)
+}
+
+// syslogName returns s, or def if s is empty, limited to max printable
+// ASCII characters other than space, '=', ']' and '"' as RFC 5424 requires
+// of its header fields and parameter names.
+func syslogName(s, def string, max int) string {
+	if s == "" {
+		s = def
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		c := s[i]
+		if c <= ' ' || c >= utf8.RuneSelf || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// appendSDValue appends s escaped as a structured data parameter value.
+func appendSDValue(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\\', ']':
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, s[i])
+	}
+	return buf
+}
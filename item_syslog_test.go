@@ -0,0 +1,99 @@
+package log4g
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFrame reads a message framed by octet counting.
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil {
+		t.Fatalf("frame length %q: %v", size, err)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+func TestSyslogOctetCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	l := itemLogger(t, `"flag": "", "prefix": "[app] "`, `{"output": "syslog", "network": "tcp", "address": "`+ln.Addr().String()+`",
+		"facility": "local0", "app_name": "my app", "proc_id": "42", "msg_id": "audit"}`)
+	defer l.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	waitConnected(t, l)
+
+	l.Error("disk full\nretrying", Fields{"user id": 7, "path": `C:\a "b"]`})
+	l.Info("ok")
+	r := bufio.NewReader(conn)
+	msg := readFrame(t, r)
+	hostname, _ := os.Hostname()
+	header := "<131>1 "
+	if !strings.HasPrefix(msg, header) {
+		t.Fatalf("message %q, want the header %q", msg, header)
+	}
+	fields := strings.SplitN(msg[len(header):], " ", 5)
+	if len(fields) < 5 || fields[1] != syslogName(hostname, "-", 255) || fields[2] != "my_app" || fields[3] != "42" || !strings.HasPrefix(fields[4], "audit ") {
+		t.Errorf("header fields %q", fields)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		t.Errorf("timestamp %q: %v", fields[0], err)
+	}
+	want := ` [fields@32473 path="C:\\a \"b\"\]" user_id="7"] [app] disk full` + "\nretrying"
+	if !strings.HasSuffix(msg, want) {
+		t.Errorf("message %q, want the end %q", msg, want)
+	}
+	if msg := readFrame(t, r); !strings.HasPrefix(msg, "<134>1 ") || !strings.HasSuffix(msg, " audit - [app] ok") {
+		t.Errorf("message %q", msg)
+	}
+}
+
+func TestSyslogRFC3164(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	l := itemLogger(t, `"flag": "", "prefix": "[app] "`, `{"output": "syslog", "network": "udp", "address": "`+conn.LocalAddr().String()+`",
+		"facility": "local0", "app_name": "my app", "proc_id": "42", "syslog_format": "rfc3164"}`)
+	defer l.Close()
+	waitConnected(t, l)
+
+	l.Warn("low memory", Fields{"free": "10MB"})
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a datagram is not framed
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<132>") || !strings.HasSuffix(msg, " my_app[42]: [app] low memory free=10MB") {
+		t.Errorf("message %q", msg)
+	}
+	if _, err := time.Parse(time.Stamp, msg[5:5+len(time.Stamp)]); err != nil {
+		t.Errorf("timestamp of %q: %v", msg, err)
+	}
+}
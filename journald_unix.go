@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package log4g
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+)
+
+// tooLarge reports whether err means that a datagram is too large to send.
+func tooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendJournalFile writes the record p to an unlinked file in /dev/shm, or
+// in the temporary directory, and passes its descriptor to journald, as
+// sd_journal_send does when memfd is not at hand.
+func sendJournalFile(conn *net.UnixConn, p []byte) error {
+	f, err := ioutil.TempFile("/dev/shm", "log4g-journal-")
+	if err != nil {
+		if f, err = ioutil.TempFile("", "log4g-journal-"); err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+	os.Remove(f.Name())
+	if _, err = f.Write(p); err != nil {
+		return err
+	}
+	// WriteMsgUnix refuses connected datagram sockets, so go through sendmsg.
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	werr := raw.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
@@ -0,0 +1,14 @@
+package log4g
+
+import (
+	"errors"
+	"net"
+)
+
+func tooLarge(err error) bool {
+	return false
+}
+
+func sendJournalFile(conn *net.UnixConn, p []byte) error {
+	return errors.New("log4g: journald is not available on windows")
+}
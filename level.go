@@ -1,10 +1,13 @@
 package log4g
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Level uint64
@@ -21,66 +24,310 @@ const (
 	LEVEL_ALL   Level = math.MaxUint64
 )
 
+var levelNames = []string{"OFF", "PANIC", "FATAL", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}
+
+// levelTable holds the names, aliases and colors of the levels. A table in
+// use is never modified: a change builds a new table and swaps it in, so
+// readers need the lock only to get the current one.
+type levelTable struct {
+	names        map[Level]string
+	alignedNames map[Level]string
+	aliases      map[string]Level // by upper case alias
+	colors       map[Level]string
+}
+
 var (
-	levelNames   = []string{"OFF", "PANIC", "FATAL", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}
-	names        = make(map[Level]string)
-	alignedNames = make(map[Level]string)
+	levelsMu sync.RWMutex // guards levels; held for writing during a change
+	levels   = builtinLevels()
 )
 
-func initLevelName() {
+// ansi color codes for the level names written to the console
+var colorCodes = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+}
+
+func builtinLevels() *levelTable {
+	t := &levelTable{
+		names:   make(map[Level]string),
+		aliases: make(map[string]Level),
+		colors:  make(map[Level]string),
+	}
 	for i, name := range levelNames {
-		names[Level(i*100)] = name
+		t.names[Level(i*100)] = name
 	}
-	names[LEVEL_ALL] = "ALL"
-	alignLevelName()
+	t.names[LEVEL_ALL] = "ALL"
+	t.align()
+	return t
 }
 
-func (l Level) Name() string {
-	if name, ok := names[l]; ok {
-		return name
+// currentLevels returns the level table in use.
+func currentLevels() *levelTable {
+	levelsMu.RLock()
+	defer levelsMu.RUnlock()
+	return levels
+}
+
+// updateLevels applies change to a copy of the level table, and puts the
+// copy in use if change succeeds. A failed change leaves the levels as they
+// were.
+func updateLevels(change func(t *levelTable) error) error {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	t := &levelTable{
+		names:   make(map[Level]string, len(levels.names)),
+		aliases: make(map[string]Level, len(levels.aliases)),
+		colors:  make(map[Level]string, len(levels.colors)),
 	}
-	return "UNKNOWN"
+	for l, n := range levels.names {
+		t.names[l] = n
+	}
+	for a, l := range levels.aliases {
+		t.aliases[a] = l
+	}
+	for l, c := range levels.colors {
+		t.colors[l] = c
+	}
+	if err := change(t); err != nil {
+		return err
+	}
+	t.align()
+	levels = t
+	return nil
 }
 
-func alignLevelName() {
+func (t *levelTable) align() {
 	maxNameLen := 0
-	for _, n := range names {
+	for _, n := range t.names {
 		if len(n) > maxNameLen {
 			maxNameLen = len(n)
 		}
 	}
-	for l, n := range names {
-		alignedNames[l] = fmt.Sprintf("%"+strconv.Itoa(maxNameLen)+"s", n)
+	t.alignedNames = make(map[Level]string, len(t.names))
+	for l, n := range t.names {
+		t.alignedNames[l] = fmt.Sprintf("%"+strconv.Itoa(maxNameLen)+"s", n)
+	}
+}
+
+// lookup returns the level of a name or alias, in any case.
+func (t *levelTable) lookup(name string) (Level, bool) {
+	if l, ok := t.aliases[strings.ToUpper(name)]; ok {
+		return l, true
+	}
+	for l, n := range t.names {
+		if strings.EqualFold(n, name) {
+			return l, true
+		}
+	}
+	return 0, false
+}
+
+// add adds a custom level. Adding the same name, in any case, and number
+// again is allowed, so a reload can declare its levels once more.
+func (t *levelTable) add(name string, l Level) error {
+	if n, ok := t.names[l]; ok {
+		if strings.EqualFold(n, name) {
+			return nil
+		}
+		return fmt.Errorf("the level %d has existed", uint64(l))
+	}
+	if existing, ok := t.lookup(name); ok {
+		return fmt.Errorf("the level name %s has existed as %d", name, uint64(existing))
+	}
+	t.names[l] = name
+	return nil
+}
+
+func (l Level) Name() string {
+	if name, ok := currentLevels().names[l]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// String returns the level name, or its number if the level is unknown.
+func (l Level) String() string {
+	if name, ok := currentLevels().names[l]; ok {
+		return name
 	}
+	return strconv.FormatUint(uint64(l), 10)
+}
+
+// Set parses a level name, alias or number, for use as a flag.Value.
+func (l *Level) Set(s string) error {
+	if level, ok := lookupLevel(s); ok {
+		*l = level
+		return nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid log level %s", s)
+	}
+	*l = Level(n)
+	return nil
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	return l.Set(string(text))
+}
+
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
 }
 
 func getAlignedName(level Level) string {
-	return alignedNames[level]
+	return currentLevels().alignedNames[level]
 }
 
-// custom log level
+// custom log level. The name is kept as given and matched in any case.
 func ForLevelName(name string, intLevel uint64) Level {
 	l := Level(intLevel)
-	if hasLevel(l) {
-		panic(fmt.Sprintf("the level %d has existed", intLevel))
+	if err := registerLevel(name, l); err != nil {
+		panic(err.Error())
 	}
-	names[l] = name
-	alignLevelName()
 	return l
 }
 
+// registerLevel adds a custom level, see levelTable.add.
+func registerLevel(name string, l Level) error {
+	return updateLevels(func(t *levelTable) error {
+		return t.add(name, l)
+	})
+}
+
+// registerLevels adds the levels declared in a config, before its items are
+// built. Either all of them are added or, on error, none.
+func registerLevels(lcs []*levelConfig) error {
+	return updateLevels(func(t *levelTable) error {
+		for _, lc := range lcs {
+			l := Level(lc.Value)
+			if err := t.add(lc.Name, l); err != nil {
+				return err
+			}
+			if lc.Alias != "" {
+				alias := strings.ToUpper(lc.Alias)
+				if existing, ok := t.lookup(alias); ok && existing != l {
+					return fmt.Errorf("the level alias %s has existed as %d", alias, uint64(existing))
+				}
+				t.aliases[alias] = l
+			}
+			if lc.Color != "" {
+				code, ok := colorCodes[strings.ToLower(lc.Color)]
+				if !ok {
+					return fmt.Errorf("invalid color %s of level %s", lc.Color, lc.Name)
+				}
+				t.colors[l] = code
+			}
+		}
+		return nil
+	})
+}
+
+// checkLevels reports the first level of c, its items, failover children
+// included, or its sections that is neither known nor declared in c.
+func checkLevels(c *Config) error {
+	declared := make(map[string]bool)
+	for _, lc := range c.Levels {
+		declared[strings.ToUpper(lc.Name)] = true
+		declared[strings.ToUpper(lc.Alias)] = true
+	}
+	valid := func(name string) error {
+		if _, ok := lookupLevel(name); name != "" && !ok && !declared[strings.ToUpper(name)] {
+			return fmt.Errorf("log4g: invalid level %s", name)
+		}
+		return nil
+	}
+	// the items of a failover item are checked with it
+	var items func(lcs []*loggerConfig) error
+	items = func(lcs []*loggerConfig) error {
+		for _, lc := range lcs {
+			if err := valid(lc.Level); err != nil {
+				return err
+			}
+			if err := items(lc.Items); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var check func(c *Config) error
+	check = func(c *Config) error {
+		if err := valid(c.Level); err != nil {
+			return err
+		}
+		if err := items(c.Items); err != nil {
+			return err
+		}
+		for _, sc := range c.Loggers {
+			if sc == nil {
+				continue
+			}
+			if err := check(sc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(c)
+}
+
 // check log level
 func hasLevel(l Level) bool {
-	_, ok := names[l]
+	_, ok := currentLevels().names[l]
 	return ok
 }
 
 func GetLevelByName(name string) Level {
-	upname := strings.ToUpper(name)
-	for l, n := range names {
-		if n == upname {
-			return l
-		}
+	if l, ok := lookupLevel(name); ok {
+		return l
 	}
 	panic("invalid log name " + name)
 }
+
+func lookupLevel(name string) (Level, bool) {
+	return currentLevels().lookup(name)
+}
+
+// tempLevel reverts temporary level changes once their ttl expires.
+type tempLevel struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	base  Level // the level before the pending temporary change
+	gen   int
+}
+
+func (t *tempLevel) set(get func() Level, set func(Level), level Level, ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	} else {
+		t.base = get()
+	}
+	t.gen++
+	set(level)
+	if ttl <= 0 {
+		return
+	}
+	gen := t.gen
+	t.timer = time.AfterFunc(ttl, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.gen == gen {
+			set(t.base)
+			t.timer = nil
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package log4g
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keepLevels returns a function putting back the levels in use, so a test
+// declaring levels leaves the names and their alignment as they were.
+func keepLevels() func() {
+	saved := currentLevels()
+	return func() {
+		levelsMu.Lock()
+		levels = saved
+		levelsMu.Unlock()
+	}
+}
+
+func TestConfigLevels(t *testing.T) {
+	defer keepLevels()()
+	l, read, cleanup := newFileLogger(t, `{
+		"levels": [{"name": "Notice", "value": 450, "alias": "N"}],
+		"level": "notice",
+		"items": [{"output": "file", "filename": "$OUT"}]
+	}`)
+	defer cleanup()
+	l.Log(GetLevelByName("n"), "noticed")
+	l.Info("hidden")
+	got := read()
+	if !strings.Contains(got, "Notice") || !strings.Contains(got, "noticed") || strings.Contains(got, "hidden") {
+		t.Errorf("custom level wrote:\n%s", got)
+	}
+	var level Level
+	if err := level.Set("NOTICE"); err != nil || level != 450 {
+		t.Errorf("Set(NOTICE) = %v, %v", level, err)
+	}
+}
+
+func TestRegisterLevelsAtomic(t *testing.T) {
+	defer keepLevels()()
+	err := registerLevels([]*levelConfig{
+		{Name: "AUDIT", Value: 250, Alias: "AU"},
+		{Name: "LOUD", Value: 150, Color: "purple"},
+	})
+	if err == nil {
+		t.Fatal("no error on an invalid color")
+	}
+	if _, ok := lookupLevel("AUDIT"); ok {
+		t.Error("level of a failed declaration registered")
+	}
+	if _, ok := lookupLevel("AU"); ok {
+		t.Error("alias of a failed declaration registered")
+	}
+}
+
+func TestUnknownLevelRejected(t *testing.T) {
+	defer keepLevels()()
+	for _, config := range []string{
+		`{"items": [{"output": "stdout", "level": "LOUD"}]}`,
+		`{"items": [{"output": "failover", "items": [{"output": "stdout", "level": "LOUD"}]}]}`,
+		`{"levels": [{"name": "AUDIT", "value": 250}], "loggers": {"db": {"level": "LOUD"}}}`,
+	} {
+		dir := writeConfigs(t, map[string]string{"log4g.json": config})
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "log4g.json")
+		c := NewConfig()
+		if err := loadConfig(filename, c); err == nil || !strings.Contains(err.Error(), "LOUD") {
+			t.Errorf("%s: error %v", config, err)
+		}
+		if len(c.Items) != 0 || len(c.Loggers) != 0 {
+			t.Errorf("%s: config changed to %+v", config, c)
+		}
+		if _, ok := lookupLevel("AUDIT"); ok {
+			t.Errorf("%s: level of a rejected config registered", config)
+		}
+		// the logger falls back to the default config
+		l := NewLogger(filename)
+		if len(l.itemConfs) != 1 || l.itemConfs[0].Output != "stdout" {
+			t.Errorf("%s: items %+v", config, l.itemConfs)
+		}
+		l.Close()
+	}
+}
+
+func TestForLevelNameKeepsCase(t *testing.T) {
+	defer keepLevels()()
+	l := ForLevelName("Verbose", 650)
+	if l.Name() != "Verbose" {
+		t.Errorf("name %q, want Verbose", l.Name())
+	}
+	if GetLevelByName("VERBOSE") != l {
+		t.Error("name not matched in upper case")
+	}
+}
+
+func TestRegisterLevelsConcurrent(t *testing.T) {
+	defer keepLevels()()
+	item := newLoggerItem(LEVEL_ALL, "", LstdFlags, nil, 0)
+	item.color = true
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			registerLevels([]*levelConfig{{Name: "LEVEL" + string(rune('A'+i%26)), Value: uint64(1000 + i%26), Color: "red"}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var buf []byte
+		for i := 0; i < 100; i++ {
+			buf = buf[:0]
+			item.formatHeader(&buf, time.Now(), Level(1000+i%26), "", 0)
+			lookupLevel("LEVELA")
+		}
+	}()
+	wg.Wait()
+}
@@ -4,9 +4,10 @@ import (
 	"log"
 	"os"
 	"time"
-	"flag"
 	"github.com/carsonsx/gutil"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -14,21 +15,45 @@ const (
 	customCallDepth  = 4
 )
 
-var exportLoggers = newLogger(exportCallDepth, defaultConfigFilepath...)
+var (
+	loggersMu     sync.Mutex
+	loggers       []*Logger
+	exportLoggers = newLogger(exportCallDepth, configFilepath()...)
+)
 
-func init() {
-	argLevel := parseArgLevel()
-	if argLevel != "" {
-		exportLoggers.argLevel = GetLevelByName(argLevel)
+// reloadAll reloads every open logger from the files it was created with.
+func reloadAll() {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	for _, l := range loggers {
+		if !l.isClosed() {
+			l.Reload()
+		}
 	}
 }
 
-func parseArgLevel() string {
-	var level string
-	cmd := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
-	cmd.StringVar(&level, "log4g.level", "", "set log4g log level")
-	cmd.Parse(os.Args[1:])
-	return level
+// register adds l to the loggers that flags and env changes apply to.
+func register(l *Logger) {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	for _, ls := range loggers {
+		if ls == l {
+			return
+		}
+	}
+	loggers = append(loggers, l)
+}
+
+// unregister removes l from the loggers, so a closed logger can be freed.
+func unregister(l *Logger) {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	for i, ls := range loggers {
+		if ls == l {
+			loggers = append(loggers[:i], loggers[i+1:]...)
+			return
+		}
+	}
 }
 
 func NewLogger(filepath ...string) *Logger {
@@ -36,80 +61,281 @@ func NewLogger(filepath ...string) *Logger {
 }
 
 func newLogger(calldepth int, filepath ...string) *Logger {
-	initLevelName()
 	ls := new(Logger)
 	ls.calldepth = calldepth
+	ls.setArgLevel(argLevel())
 	ls.LoadConfig(filepath...)
+	register(ls)
 	return ls
 }
 
 type Logger struct {
 	items     []LoggerItem
+	itemConfs []*loggerConfig // the config of each item
+	metrics   []*itemMetrics  // the counters of each item
+	health    []*itemHealth   // the health of each item
+	label     string          // the name of l in the metrics
+	onError   atomic.Value    // the errorHandler set by SetErrorHandler
+	named     map[string]LoggerItem
 	config    *Config
+	filepath  []string
 	argLevel  Level
+	tempLevel tempLevel
 	calldepth int
 	closed    bool
+	vmodule   *vmodule
+	signals   chan os.Signal
+	control   chan struct{} // closed to stop the redis control
+	pollStop  chan struct{}
+	sigBase   Level // the level before SIGUSR1 cycles
+	parent    *Logger
+	name      string
+	shared    bool         // the items belong to the parent
+	rw        sync.RWMutex // guards the items and config against reloads and close
+	mu        sync.Mutex   // protects children
+	children  map[string]*Logger
 }
 
 func (l *Logger) LoadConfig(filepath ...string) {
-	l.closed = true
-	l.Close()
+	l.lockAll()
+	l.closeItems()
+	l.filepath = filepath
 	l.config = NewConfig()
 	gutil.ListenFirstValidJsonFile(l.config, loadConfig, filepath...)
 
+	l.buildItems()
+	l.mu.Lock()
+	for _, child := range l.children {
+		child.buildItems()
+		child.closed = false
+	}
+	l.mu.Unlock()
+
+	l.closed = false
+	l.unlockAll()
+	l.startControl()
+	l.startPolling()
+}
+
+// lockAll write-locks l and its named loggers, which may share its items.
+func (l *Logger) lockAll() {
+	l.rw.Lock()
+	l.mu.Lock()
+	for _, child := range l.children {
+		child.lockAll()
+	}
+	l.mu.Unlock()
+}
+
+func (l *Logger) unlockAll() {
+	l.mu.Lock()
+	for _, child := range l.children {
+		child.unlockAll()
+	}
+	l.mu.Unlock()
+	l.rw.Unlock()
+}
+
+// buildItems creates the items of l from its config. A named logger whose
+// section is missing shares the items of its parent.
+func (l *Logger) buildItems() {
+
+	l.label = l.metricsLabel()
+	var refs map[string]LoggerItem
+	if l.parent != nil {
+		refs = l.parent.named
+		l.config = l.parent.config.section(l.name)
+		l.shared = l.config == nil
+		if l.shared {
+			l.config = l.parent.config
+			l.items = l.parent.items
+			l.itemConfs = l.parent.itemConfs
+			l.metrics = l.parent.metrics
+			l.health = l.parent.health
+			l.vmodule = l.parent.vmodule
+			return
+		}
+	}
+
 	//clear loggers
 	l.items = []LoggerItem{}
+	l.itemConfs = []*loggerConfig{}
+	l.metrics = []*itemMetrics{}
+	l.health = []*itemHealth{}
+	l.named = make(map[string]LoggerItem)
+	l.vmodule, _ = parseVmodule(l.config.Vmodule)
 
+	taken := make(map[string]bool)
 	if len(l.config.Items) == 0 {
-		l.items = append(l.items, newLoggerItem(l.GetLevel(), l.config.Prefix, parseFlag(l.config.Flag), os.Stdout, l.calldepth))
+		item := newLoggerItem(l.getLevel(), l.config.Prefix, parseFlag(l.config.Flag), os.Stdout, l.calldepth)
+		h := &itemHealth{item: "stdout", logger: l}
+		item.monitor(metricsFor(l.label, "stdout"), h)
+		l.items = append(l.items, item)
+		l.itemConfs = append(l.itemConfs, &loggerConfig{Output: "stdout"})
+		l.metrics = append(l.metrics, item.metrics)
+		l.health = append(l.health, h)
 	} else {
-		for _, lc := range l.config.Items {
+		for i, lc := range l.config.Items {
 			if lc.Disabled {
 				continue
 			}
-			prefix := l.config.Prefix
-			if lc.Prefix != "" {
-				prefix = lc.Prefix
-			}
-			flag := parseFlag(l.config.Flag)
-			if lc.Flag != "" {
-				flag = parseFlag(lc.Flag)
-			}
-			level := GetLevelByName(l.config.Level)
-			if lc.Level != "" {
-				level = GetLevelByName(lc.Level)
-			}
-			var logger LoggerItem
-			switch lc.Output {
-			case "stdout":
-				logger = newStdoutLoggerItem(level, prefix, flag, l.calldepth)
-			case "stderr":
-				logger = newStderrLoggerItem(level, prefix, flag, l.calldepth)
-			case "file":
-				logger = newFileLoggerItem(level, prefix, flag, lc.Filename, lc.Buffer, lc.MaxLines, lc.Maxsize, lc.MaxCount, lc.Daily, l.calldepth)
-			case "redis":
-				logger = newRedisLoggerItem(level, prefix, flag, lc, l.calldepth)
-			case "socket":
-				logger = newSocketLoggerItem(level, prefix, flag, lc, l.calldepth)
-			}
+			logger := newItem(lc, l.config, refs, l.calldepth)
 			if logger != nil {
 				l.items = append(l.items, logger)
+				l.itemConfs = append(l.itemConfs, lc)
+				label := itemLabel(lc, i, taken)
+				m := metricsFor(l.label, label)
+				h := &itemHealth{item: label, logger: l}
+				if g, ok := logger.(monitored); ok {
+					g.monitor(m, h)
+				}
+				l.metrics = append(l.metrics, m)
+				l.health = append(l.health, h)
+				if lc.Name != "" {
+					l.named[lc.Name] = logger
+				} else if lc.Ref != "" {
+					l.named[lc.Ref] = logger
+				}
 			}
 		}
 	}
+}
 
-	l.closed = false
+// newItem creates the item declared by lc. Prefix, flag and level default to
+// those of config. An item with a ref writes through the item of that name
+// in refs, which holds the named items of the top level only.
+func newItem(lc *loggerConfig, config *Config, refs map[string]LoggerItem, calldepth int) LoggerItem {
+	prefix := config.Prefix
+	if lc.Prefix != "" {
+		prefix = lc.Prefix
+	}
+	flag := parseFlag(config.Flag)
+	if lc.Flag != "" {
+		flag = parseFlag(lc.Flag)
+	}
+	level := GetLevelByName(config.Level)
+	if lc.Level != "" {
+		level = GetLevelByName(lc.Level)
+	}
+	if lc.Ref != "" {
+		target, ok := refs[lc.Ref]
+		if !ok {
+			log.Printf("log4g: no item named %s to refer to", lc.Ref)
+			return nil
+		}
+		return newRefLoggerItem(level, prefix, flag, target, calldepth)
+	}
+	switch lc.Output {
+	case "stdout":
+		return newStdoutLoggerItem(level, prefix, flag, calldepth)
+	case "stderr":
+		return newStderrLoggerItem(level, prefix, flag, calldepth)
+	case "file":
+		return newFileLoggerItem(level, prefix, flag, lc.Filename, lc.Buffer, lc.MaxLines, lc.Maxsize, lc.MaxCount, lc.Daily, calldepth)
+	case "redis":
+		return newRedisLoggerItem(level, prefix, flag, lc, calldepth)
+	case "socket":
+		return newSocketLoggerItem(level, prefix, flag, lc, calldepth)
+	case "syslog":
+		return newSyslogLoggerItem(level, prefix, flag, lc, calldepth)
+	case "gelf":
+		return newGelfLoggerItem(level, prefix, flag, lc, calldepth)
+	case "fluent":
+		return newFluentLoggerItem(level, prefix, flag, lc, calldepth)
+	case "loki":
+		return newLokiLoggerItem(level, prefix, flag, lc, calldepth)
+	case "otlp":
+		return newOTLPLoggerItem(level, prefix, flag, lc, calldepth)
+	case "http":
+		return newHTTPLoggerItem(level, prefix, flag, lc, calldepth)
+	case "journald":
+		return newJournaldLoggerItem(level, prefix, flag, lc, calldepth)
+	case "failover":
+		return newFailoverLoggerItem(level, prefix, flag, lc, config, refs, calldepth)
+	}
+	return nil
+}
+
+// Named returns the logger declared in the "loggers" section name of the
+// config. Its items may refer to the named items of l to share their
+// output. Without such a section it shares the items of l.
+func (l *Logger) Named(name string) *Logger {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if child, ok := l.children[name]; ok {
+		return child
+	}
+	child := new(Logger)
+	child.calldepth = customCallDepth
+	child.parent = l
+	child.name = name
+	child.setArgLevel(argLevel())
+	child.buildItems()
+	if l.children == nil {
+		l.children = make(map[string]*Logger)
+	}
+	l.children[name] = child
+	return child
+}
+
+// Reload loads the config again from the files the logger was created with,
+// picking up the current env profile.
+func (l *Logger) Reload() {
+	if l.parent != nil {
+		l.parent.Reload()
+		return
+	}
+	l.LoadConfig(l.filepath...)
+}
+
+// String describes the logger by its config, with secrets redacted.
+func (l *Logger) String() string {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return "Logger" + l.config.String()
 }
 
 func (l *Logger) GetLevel() Level {
-	if l.argLevel > 0 {
-		return l.argLevel
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.getLevel()
+}
+
+func (l *Logger) getLevel() Level {
+	if argLevel := l.getArgLevel(); argLevel > 0 {
+		return argLevel
 	}
 	return GetLevelByName(l.config.Level)
 }
 
 func (l *Logger) SetLevel(level Level) {
-	l.argLevel = level
+	l.SetLevelFor(level, 0)
+}
+
+// SetLevelFor sets the level for ttl, after which the level before the first
+// of consecutive temporary changes comes back. A ttl of 0 sets it for good.
+func (l *Logger) SetLevelFor(level Level, ttl time.Duration) {
+	l.tempLevel.set(l.getArgLevel, l.setArgLevel, level, ttl)
+}
+
+func (l *Logger) getArgLevel() Level {
+	return Level(atomic.LoadUint64((*uint64)(&l.argLevel)))
+}
+
+func (l *Logger) setArgLevel(level Level) {
+	atomic.StoreUint64((*uint64)(&l.argLevel), uint64(level))
+}
+
+// setArgLevelAll sets the level of l and of its named loggers.
+func (l *Logger) setArgLevelAll(level Level) {
+	l.setArgLevel(level)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, child := range l.children {
+		child.setArgLevelAll(level)
+	}
 }
 
 func (l *Logger) Panic(arg interface{}, args ...interface{}) {
@@ -185,26 +411,70 @@ func (l *Logger) IsTraceEnabled() bool {
 }
 
 func (l *Logger) IsLevel(level Level) bool {
-	for _, logger := range l.items {
-		if logger.GetLevel() >= level {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.isLevel(level)
+}
+
+func (l *Logger) isLevel(level Level) bool {
+	argLevel := l.getArgLevel()
+	for i, logger := range l.items {
+		if argLevel > 0 && l.follows(i) {
+			if argLevel >= level {
+				return true
+			}
+		} else if logger.GetLevel() >= level {
 			return true
 		}
 	}
 	return false
 }
 
+// follows reports whether the item i of l takes its level from l, so that a
+// level set on l replaces it. A level given to the item in the config or set
+// with SetLevelFor filters the records whatever the level of l.
+func (l *Logger) follows(i int) bool {
+	if l.itemConfs[i].Level != "" {
+		return false
+	}
+	p, ok := l.items[i].(interface {
+		isPinned() bool
+	})
+	return !ok || !p.isPinned()
+}
+
 func (l *Logger) Log(level Level, arg interface{}, args ...interface{}) {
+	l.log(l.calldepth+1, level, arg, args...)
+}
+
+// log writes a record for the caller calldepth frames above the item output.
+// A level set on the logger replaces the levels its items take from it, and
+// a vmodule level matching the caller replaces both the logger and the item
+// levels.
+func (l *Logger) log(calldepth int, level Level, arg interface{}, args ...interface{}) {
+
+	l.rw.RLock()
+	defer l.rw.RUnlock()
 
 	if l.closed {
 		return
 	}
 
-	if l.argLevel > 0 && l.argLevel < level  {
-		return
+	vlevel, force := l.vmodule.levelAt(calldepth)
+	follow := false
+	if force {
+		if vlevel < level {
+			return
+		}
+	} else if argLevel := l.getArgLevel(); argLevel > 0 {
+		if argLevel < level {
+			return
+		}
+		follow = true
 	}
 
 	if f, ok := arg.(func() (arg interface{}, args []interface{})); ok {
-		if l.IsLevel(level) {
+		if force || l.isLevel(level) {
 			defer func() {
 				if r := recover(); r != nil {
 					log.Println(r)
@@ -213,31 +483,130 @@ func (l *Logger) Log(level Level, arg interface{}, args ...interface{}) {
 			arg, args = f()
 		}
 	}
+	l.write(calldepth+1, level, force, follow, arg, args...)
+}
+
+// notice writes a record of a change made to l at WARN to all its items,
+// whatever their levels and the level of l, so that the change is seen.
+func (l *Logger) notice(arg interface{}, args ...interface{}) {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	if !l.closed {
+		l.write(l.calldepth+1, LEVEL_WARN, true, false, arg, args...)
+	}
+}
 
+// write hands the record to the items of l, bypassing their levels if force
+// is set, and the levels they take from l if follow is set.
+func (l *Logger) write(calldepth int, level Level, force bool, follow bool, arg interface{}, args ...interface{}) {
 	now := time.Now()
-	for _, item := range l.items {
+	written := false
+	for i, item := range l.items {
 		item.Before(now)
-		n, err := item.Log(now, level, arg, args...)
+		var n int
+		var err error
+		if d, ok := item.(depthLogger); ok {
+			n, err = d.logDepth(now, calldepth, level, force || follow && l.follows(i), arg, args...)
+		} else {
+			n, err = item.Log(now, level, arg, args...)
+		}
 		if err == nil {
 			item.After(now, n)
+			if n > 0 {
+				l.metrics[i].written(n)
+				written = true
+			}
 		} else {
-			log.Println(err)
+			if err == errItemStopped || err == errQueueFull {
+				l.metrics[i].dropped()
+			} else {
+				l.metrics[i].failed()
+				l.health[i].fail(err)
+			}
 		}
 	}
+	if written {
+		countLevel(l.label, level)
+	}
 }
 
 func (l *Logger) Open() {
+	l.rw.Lock()
 	l.closed = false
+	l.rw.Unlock()
+	if l.parent == nil {
+		register(l)
+	}
+}
+
+func (l *Logger) isClosed() bool {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.closed
 }
 
 func (l *Logger) Flush() {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
 	for _, logger := range l.items {
 		logger.Flush()
 	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, child := range l.children {
+		child.Flush()
+	}
+}
+
+// Reopen closes and opens again the files and connections of the items,
+// e.g. after an external tool rotated them. It returns the last error met.
+func (l *Logger) Reopen() error {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	var err error
+	if !l.shared {
+		for _, logger := range l.items {
+			if r, ok := logger.(interface {
+				Reopen() error
+			}); ok {
+				if e := r.Reopen(); e != nil {
+					err = e
+				}
+			}
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, child := range l.children {
+		if e := child.Reopen(); e != nil {
+			err = e
+		}
+	}
+	return err
 }
 
+// Close closes the items and stops the signal handlers, if any. Flags and
+// env changes no longer apply to a closed logger.
 func (l *Logger) Close() {
+	l.stopSignals()
+	unregister(l)
+	l.lockAll()
+	defer l.unlockAll()
+	l.closeItems()
+}
+
+func (l *Logger) closeItems() {
+	l.stopControl()
+	l.stopPolling()
 	l.closed = true
+	l.mu.Lock()
+	for _, child := range l.children {
+		child.closeItems()
+	}
+	l.mu.Unlock()
+	if l.shared {
+		return
+	}
 	for _, logger := range l.items {
 		logger.Close()
 	}
@@ -0,0 +1,69 @@
+package log4g
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func registered(l *Logger) bool {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	for _, ls := range loggers {
+		if ls == l {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCloseUnregisters(t *testing.T) {
+	l, _, cleanup := newFileLogger(t, `{"items": [{"output": "file", "filename": "$OUT"}]}`)
+	defer cleanup()
+	if !registered(l) {
+		t.Fatal("new logger not registered")
+	}
+	l.Close()
+	if registered(l) {
+		t.Error("closed logger still registered")
+	}
+	reloadAll()
+	if !l.isClosed() {
+		t.Error("closed logger reloaded")
+	}
+}
+
+func TestInvalidLevelVariable(t *testing.T) {
+	os.Setenv("LOG4G_LEVEL", "LOUD")
+	defer os.Unsetenv("LOG4G_LEVEL")
+	l, read, cleanup := newFileLogger(t, `{"level": "info", "items": [{"output": "file", "filename": "$OUT"}]}`)
+	defer cleanup()
+	l.Info("written")
+	if !strings.Contains(read(), "written") {
+		t.Error("record not written with an invalid LOG4G_LEVEL")
+	}
+}
+
+func TestLevelArgReachesNamed(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{
+		"level": "info",
+		"items": [{"name": "out", "output": "file", "filename": "$OUT"}],
+		"loggers": {"db": {"items": [{"ref": "out"}]}}
+	}`)
+	defer cleanup()
+	db := l.Named("db")
+	defer func() {
+		gArgs.level = ""
+		applyLevelArg()
+	}()
+	gArgs.level = "DEBUG"
+	applyLevelArg()
+	db.Debug("from db")
+	l.Named("cache").Debug("from cache")
+	got := read()
+	for _, s := range []string{"from db", "from cache"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not written:\n%s", s, got)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package log4g
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// itemMetrics counts what an item did. All fields are accessed atomically
+// and a nil *itemMetrics counts nothing.
+type itemMetrics struct {
+	records   int64
+	bytes     int64
+	errors    int64
+	rotations int64
+	drops     int64
+	switches  int64 // of a failover item to another child
+	spools    int64 // records written to the spool
+	replays   int64 // records delivered from the spool
+	discards  int64 // records removed from the spool undelivered
+	queue     int64 // records waiting to be written, a gauge
+}
+
+func (m *itemMetrics) add(p *int64, n int64) {
+	if m != nil {
+		atomic.AddInt64(p, n)
+	}
+}
+
+func (m *itemMetrics) written(n int) {
+	if m != nil {
+		atomic.AddInt64(&m.records, 1)
+		atomic.AddInt64(&m.bytes, int64(n))
+	}
+}
+
+func (m *itemMetrics) failed() {
+	if m != nil {
+		m.add(&m.errors, 1)
+	}
+}
+
+func (m *itemMetrics) rotated() {
+	if m != nil {
+		m.add(&m.rotations, 1)
+	}
+}
+
+func (m *itemMetrics) dropped() {
+	if m != nil {
+		m.add(&m.drops, 1)
+	}
+}
+
+// droppedBatch counts the n records of a batch that could not be sent.
+func (m *itemMetrics) droppedBatch(n int) {
+	if m != nil {
+		m.add(&m.drops, int64(n))
+	}
+}
+
+// queued adds n, which may be negative, to the records waiting in the queue.
+func (m *itemMetrics) queued(n int) {
+	if m != nil {
+		m.add(&m.queue, int64(n))
+	}
+}
+
+func (m *itemMetrics) switched() {
+	if m != nil {
+		m.add(&m.switches, 1)
+	}
+}
+
+func (m *itemMetrics) spooled() {
+	if m != nil {
+		m.add(&m.spools, 1)
+	}
+}
+
+func (m *itemMetrics) replayed() {
+	if m != nil {
+		m.add(&m.replays, 1)
+	}
+}
+
+func (m *itemMetrics) discarded(n int64) {
+	if m != nil {
+		m.add(&m.discards, n)
+	}
+}
+
+type levelKey struct {
+	logger string
+	level  Level
+}
+
+type itemKey struct {
+	logger string
+	item   string
+}
+
+// the counters live as long as the process, so they survive reloads
+var (
+	levelCounts  sync.Map // levelKey -> *int64
+	itemsMu      sync.Mutex
+	itemCounters = make(map[itemKey]*itemMetrics)
+)
+
+func init() {
+	expvar.Publish("log4g", expvar.Func(func() interface{} {
+		return metricsSnapshot()
+	}))
+}
+
+func countLevel(logger string, level Level) {
+	key := levelKey{logger, level}
+	p, ok := levelCounts.Load(key)
+	if !ok {
+		p, _ = levelCounts.LoadOrStore(key, new(int64))
+	}
+	atomic.AddInt64(p.(*int64), 1)
+}
+
+func metricsFor(logger, item string) *itemMetrics {
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+	key := itemKey{logger, item}
+	m, ok := itemCounters[key]
+	if !ok {
+		m = new(itemMetrics)
+		itemCounters[key] = m
+	}
+	return m
+}
+
+// metricsLabel names l in the metrics: the base name of its first config
+// file, prefixed by the label of its parent for a named logger.
+func (l *Logger) metricsLabel() string {
+	if l.parent != nil {
+		return l.parent.metricsLabel() + "." + l.name
+	}
+	if len(l.filepath) == 0 {
+		return "log4g"
+	}
+	name := filepath.Base(l.filepath[0])
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// itemLabel names an item in the metrics by its name, ref or output, with
+// the index appended if the same label is taken already.
+func itemLabel(lc *loggerConfig, i int, taken map[string]bool) string {
+	label := lc.Name
+	if label == "" {
+		label = lc.Ref
+	}
+	if label == "" {
+		label = lc.Output
+	}
+	if taken[label] {
+		label += "#" + strconv.Itoa(i)
+	}
+	taken[label] = true
+	return label
+}
+
+type itemSnapshot struct {
+	Records   int64 `json:"records"`
+	Bytes     int64 `json:"bytes"`
+	Errors    int64 `json:"errors"`
+	Rotations int64 `json:"rotations"`
+	Drops     int64 `json:"drops"`
+	Switches  int64 `json:"switches"`
+	Spooled   int64 `json:"spooled"`
+	Replayed  int64 `json:"replayed"`
+	Discarded int64 `json:"discarded"`
+	Queue     int64 `json:"queue"`
+}
+
+type snapshot struct {
+	Levels map[string]map[string]int64        `json:"levels"`
+	Items  map[string]map[string]itemSnapshot `json:"items"`
+}
+
+func metricsSnapshot() *snapshot {
+	s := &snapshot{
+		Levels: make(map[string]map[string]int64),
+		Items:  make(map[string]map[string]itemSnapshot),
+	}
+	levelCounts.Range(func(k, v interface{}) bool {
+		key := k.(levelKey)
+		if s.Levels[key.logger] == nil {
+			s.Levels[key.logger] = make(map[string]int64)
+		}
+		s.Levels[key.logger][key.level.String()] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+	for key, m := range itemCounters {
+		if s.Items[key.logger] == nil {
+			s.Items[key.logger] = make(map[string]itemSnapshot)
+		}
+		s.Items[key.logger][key.item] = itemSnapshot{
+			Records:   atomic.LoadInt64(&m.records),
+			Bytes:     atomic.LoadInt64(&m.bytes),
+			Errors:    atomic.LoadInt64(&m.errors),
+			Rotations: atomic.LoadInt64(&m.rotations),
+			Drops:     atomic.LoadInt64(&m.drops),
+			Switches:  atomic.LoadInt64(&m.switches),
+			Spooled:   atomic.LoadInt64(&m.spools),
+			Replayed:  atomic.LoadInt64(&m.replays),
+			Discarded: atomic.LoadInt64(&m.discards),
+			Queue:     atomic.LoadInt64(&m.queue),
+		}
+	}
+	return s
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format. They are
+// also published through expvar as "log4g".
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, metricsSnapshot())
+	})
+}
+
+func writeMetrics(w http.ResponseWriter, s *snapshot) {
+	fmt.Fprintln(w, "# HELP log4g_records_total Records written, by logger and level.")
+	fmt.Fprintln(w, "# TYPE log4g_records_total counter")
+	for _, logger := range sortedKeys(s.Levels) {
+		levels := s.Levels[logger]
+		names := make([]string, 0, len(levels))
+		for name := range levels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "log4g_records_total{logger=%s,level=%s} %d\n", promLabel(logger), promLabel(name), levels[name])
+		}
+	}
+	series := []struct {
+		name, kind, help string
+		value            func(itemSnapshot) int64
+	}{
+		{"log4g_item_records_total", "counter", "Records written by the item.", func(s itemSnapshot) int64 { return s.Records }},
+		{"log4g_item_bytes_total", "counter", "Bytes written by the item.", func(s itemSnapshot) int64 { return s.Bytes }},
+		{"log4g_item_errors_total", "counter", "Failed writes of the item.", func(s itemSnapshot) int64 { return s.Errors }},
+		{"log4g_item_rotations_total", "counter", "File rotations of the item.", func(s itemSnapshot) int64 { return s.Rotations }},
+		{"log4g_item_drops_total", "counter", "Records the item dropped.", func(s itemSnapshot) int64 { return s.Drops }},
+		{"log4g_item_failovers_total", "counter", "Switches of a failover item to another child.", func(s itemSnapshot) int64 { return s.Switches }},
+		{"log4g_item_spooled_total", "counter", "Records written to the spool of the item.", func(s itemSnapshot) int64 { return s.Spooled }},
+		{"log4g_item_replayed_total", "counter", "Records delivered from the spool of the item.", func(s itemSnapshot) int64 { return s.Replayed }},
+		{"log4g_item_discarded_total", "counter", "Records removed from the spool of the item undelivered.", func(s itemSnapshot) int64 { return s.Discarded }},
+		{"log4g_item_queue_depth", "gauge", "Records waiting in the item queue.", func(s itemSnapshot) int64 { return s.Queue }},
+	}
+	for _, m := range series {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, logger := range sortedItemKeys(s.Items) {
+			items := s.Items[logger]
+			names := make([]string, 0, len(items))
+			for name := range items {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(w, "%s{logger=%s,item=%s} %d\n", m.name, promLabel(logger), promLabel(name), m.value(items[name]))
+			}
+		}
+	}
+}
+
+// promLabel quotes a label value for the Prometheus text format, which
+// escapes only backslashes, double quotes and line feeds.
+func promLabel(s string) string {
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(append(b, '"'))
+}
+
+func sortedKeys(m map[string]map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedItemKeys(m map[string]map[string]itemSnapshot) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,61 @@
+package log4g
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.ToSlash(filepath.Join(dir, "out.log"))
+	filename := filepath.Join(dir, "métrique.json")
+	config := `{"level": "info", "items": [
+		{"name": "fichier \"principal\"", "output": "file", "filename": "` + out + `", "max_lines": 2},
+		{"name": "ligne\nsuivante", "output": "file", "filename": "` + out + `.b", "level": "error"}
+	]}`
+	if err := ioutil.WriteFile(filename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := NewLogger(filename)
+	defer l.Close()
+	l.Info("one")
+	l.Info("two")
+	l.Error("three")
+	l.Debug("hidden")
+
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	got := w.Body.String()
+	for _, line := range []string{
+		`log4g_records_total{logger="métrique",level="INFO"} 2`,
+		`log4g_records_total{logger="métrique",level="ERROR"} 1`,
+		`log4g_item_records_total{logger="métrique",item="fichier \"principal\""} 3`,
+		`log4g_item_rotations_total{logger="métrique",item="fichier \"principal\""} 1`,
+		`log4g_item_records_total{logger="métrique",item="ligne\nsuivante"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("no line %s in:\n%s", line, got)
+		}
+	}
+}
+
+func TestPromLabel(t *testing.T) {
+	for s, want := range map[string]string{
+		"plain":   `"plain"`,
+		`a"b\c`:   `"a\"b\\c"`,
+		"a\nb":    `"a\nb"`,
+		"日志\tlog": "\"日志\tlog\"",
+	} {
+		if got := promLabel(s); got != want {
+			t.Errorf("promLabel(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
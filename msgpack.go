@@ -0,0 +1,329 @@
+package log4g
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+var errMsgpack = errors.New("log4g: invalid msgpack")
+
+// msgpackExt is an extension value decoded from msgpack, such as the
+// EventTime of the fluentd Forward protocol (type 0).
+type msgpackExt struct {
+	typ  int8
+	data []byte
+}
+
+func appendMsgpackUint(buf []byte, n uint64) []byte {
+	switch {
+	case n < 1<<7:
+		return append(buf, byte(n))
+	case n < 1<<8:
+		return append(buf, 0xcc, byte(n))
+	case n < 1<<16:
+		return append(buf, 0xcd, byte(n>>8), byte(n))
+	case n < 1<<32:
+		return appendUint32(append(buf, 0xce), uint32(n))
+	}
+	buf = append(buf, 0xcf)
+	return appendUint64(buf, n)
+}
+
+func appendMsgpackInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0:
+		return appendMsgpackUint(buf, uint64(n))
+	case n >= -32:
+		return append(buf, byte(n))
+	case n >= math.MinInt8:
+		return append(buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return append(buf, 0xd1, byte(n>>8), byte(n))
+	case n >= math.MinInt32:
+		return appendUint32(append(buf, 0xd2), uint32(n))
+	}
+	buf = append(buf, 0xd3)
+	return appendUint64(buf, uint64(n))
+}
+
+func appendUint32(buf []byte, n uint32) []byte {
+	return append(buf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(buf []byte, n uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(n>>32)), uint32(n))
+}
+
+// appendMsgpackHeader appends the header of a str, bin, array or map of n
+// elements, given the fix type, if any, and the 8, 16 and 32 bit types.
+func appendMsgpackHeader(buf []byte, n int, fix int, fixMax int, t8, t16, t32 byte) []byte {
+	switch {
+	case fix >= 0 && n <= fixMax:
+		return append(buf, byte(fix|n))
+	case t8 != 0 && n < 1<<8:
+		return append(buf, t8, byte(n))
+	case n < 1<<16:
+		return append(buf, t16, byte(n>>8), byte(n))
+	}
+	return appendUint32(append(buf, t32), uint32(n))
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	buf = appendMsgpackHeader(buf, len(s), 0xa0, 31, 0xd9, 0xda, 0xdb)
+	return append(buf, s...)
+}
+
+func appendMsgpackBin(buf []byte, p []byte) []byte {
+	buf = appendMsgpackHeader(buf, len(p), -1, 0, 0xc4, 0xc5, 0xc6)
+	return append(buf, p...)
+}
+
+func appendMsgpackArray(buf []byte, n int) []byte {
+	return appendMsgpackHeader(buf, n, 0x90, 15, 0, 0xdc, 0xdd)
+}
+
+func appendMsgpackMap(buf []byte, n int) []byte {
+	return appendMsgpackHeader(buf, n, 0x80, 15, 0, 0xde, 0xdf)
+}
+
+// appendEventTime appends t as the EventTime extension of the fluentd
+// Forward protocol.
+func appendEventTime(buf []byte, t time.Time) []byte {
+	buf = append(buf, 0xd7, 0)
+	buf = appendUint32(buf, uint32(t.Unix()))
+	return appendUint32(buf, uint32(t.Nanosecond()))
+}
+
+// appendMsgpack appends v, the values other than numbers, strings, byte
+// slices, booleans, slices and maps of them being formatted as strings.
+func appendMsgpack(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if v {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case int:
+		return appendMsgpackInt(buf, int64(v))
+	case int8:
+		return appendMsgpackInt(buf, int64(v))
+	case int16:
+		return appendMsgpackInt(buf, int64(v))
+	case int32:
+		return appendMsgpackInt(buf, int64(v))
+	case int64:
+		return appendMsgpackInt(buf, v)
+	case uint:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint8:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint16:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint32:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint64:
+		return appendMsgpackUint(buf, v)
+	case float32:
+		buf = append(buf, 0xca)
+		return appendUint32(buf, math.Float32bits(v))
+	case float64:
+		buf = append(buf, 0xcb)
+		return appendUint64(buf, math.Float64bits(v))
+	case string:
+		return appendMsgpackString(buf, v)
+	case []byte:
+		return appendMsgpackBin(buf, v)
+	case []interface{}:
+		buf = appendMsgpackArray(buf, len(v))
+		for _, e := range v {
+			buf = appendMsgpack(buf, e)
+		}
+		return buf
+	case Fields:
+		return appendMsgpackFields(buf, v)
+	case map[string]interface{}:
+		return appendMsgpackFields(buf, v)
+	case []string:
+		buf = appendMsgpackArray(buf, len(v))
+		for _, e := range v {
+			buf = appendMsgpackString(buf, e)
+		}
+		return buf
+	}
+	return appendMsgpackString(buf, fmt.Sprint(v))
+}
+
+// appendMsgpackFields appends m as a map in key order.
+func appendMsgpackFields(buf []byte, m map[string]interface{}) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf = appendMsgpackMap(buf, len(keys))
+	for _, k := range keys {
+		buf = appendMsgpackString(buf, k)
+		buf = appendMsgpack(buf, m[k])
+	}
+	return buf
+}
+
+// decodeMsgpack decodes the value at the start of b and returns it with its
+// length. Strings decode as string, bin as []byte, arrays as []interface{},
+// maps as map[string]interface{} and extensions as msgpackExt. It returns
+// io.ErrUnexpectedEOF if b ends before the value.
+func decodeMsgpack(b []byte) (v interface{}, n int, err error) {
+	if len(b) == 0 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), 1, nil
+	case c >= 0xe0:
+		return int64(int8(c)), 1, nil
+	case c&0xf0 == 0x80:
+		return decodeMsgpackMap(b, 1, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return decodeMsgpackArray(b, 1, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		return decodeMsgpackBytes(b, 1, int(c&0x1f), true)
+	}
+	switch c {
+	case 0xc0:
+		return nil, 1, nil
+	case 0xc2, 0xc3:
+		return c == 0xc3, 1, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb:
+		size := 1 << ((c - 0xc4) % 3)
+		if c >= 0xd9 {
+			size = 1 << (c - 0xd9)
+		}
+		l, err := msgpackLength(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeMsgpackBytes(b, 1+size, l, c >= 0xd9)
+	case 0xc7, 0xc8, 0xc9:
+		size := 1 << (c - 0xc7)
+		l, err := msgpackLength(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeMsgpackExt(b, 1+size, l)
+	case 0xca:
+		if len(b) < 5 {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b[1:]))), 5, nil
+	case 0xcb:
+		if len(b) < 9 {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), 9, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		size := 1 << (c - 0xcc)
+		l, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return int64(l), 1 + size, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		l, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return int64(l<<(64-8*size)) >> (64 - 8*size), 1 + size, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return decodeMsgpackExt(b, 1, 1<<(c-0xd4))
+	case 0xdc, 0xdd:
+		l, err := msgpackLength(b, 2<<(c-0xdc))
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeMsgpackArray(b, 1+2<<(c-0xdc), l)
+	case 0xde, 0xdf:
+		l, err := msgpackLength(b, 2<<(c-0xde))
+		if err != nil {
+			return nil, 0, err
+		}
+		return decodeMsgpackMap(b, 1+2<<(c-0xde), l)
+	}
+	return nil, 0, errMsgpack
+}
+
+// msgpackUint returns the size bytes unsigned integer following the type
+// byte at the start of b.
+func msgpackUint(b []byte, size int) (uint64, error) {
+	if len(b) < 1+size {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var n uint64
+	for _, c := range b[1 : 1+size] {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func msgpackLength(b []byte, size int) (int, error) {
+	n, err := msgpackUint(b, size)
+	if err == nil && n > math.MaxInt32 {
+		err = errMsgpack
+	}
+	return int(n), err
+}
+
+func decodeMsgpackBytes(b []byte, start, l int, str bool) (interface{}, int, error) {
+	if len(b) < start+l {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	if str {
+		return string(b[start : start+l]), start + l, nil
+	}
+	return b[start : start+l], start + l, nil
+}
+
+func decodeMsgpackExt(b []byte, start, l int) (interface{}, int, error) {
+	if len(b) < start+1+l {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	return msgpackExt{int8(b[start]), b[start+1 : start+1+l]}, start + 1 + l, nil
+}
+
+func decodeMsgpackArray(b []byte, n, l int) (interface{}, int, error) {
+	a := make([]interface{}, 0, l)
+	for i := 0; i < l; i++ {
+		v, m, err := decodeMsgpack(b[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+		a = append(a, v)
+		n += m
+	}
+	return a, n, nil
+}
+
+func decodeMsgpackMap(b []byte, n, l int) (interface{}, int, error) {
+	m := make(map[string]interface{}, l)
+	for i := 0; i < 2*l; i += 2 {
+		k, kn, err := decodeMsgpack(b[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+		v, vn, err := decodeMsgpack(b[n+kn:])
+		if err != nil {
+			return nil, 0, err
+		}
+		m[fmt.Sprint(k)] = v
+		n += kn + vn
+	}
+	return m, n, nil
+}
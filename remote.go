@@ -0,0 +1,351 @@
+package log4g
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultConfigPoll = time.Minute
+
+var (
+	remoteClient = &http.Client{Timeout: 10 * time.Second}
+	remotesMu    sync.Mutex
+	remotes      = make(map[string]*remoteConfig)
+)
+
+// remoteConfig is a config document served over HTTP, along with the
+// documents it extends and includes. It keeps the last good documents in
+// memory and in a cache file, with the ETag of the document next to it.
+type remoteConfig struct {
+	mu      sync.Mutex
+	url     string
+	cache   string
+	etag    string
+	data    []byte   // the documents as a JSON array, as cached
+	docs    [][]byte // the documents in the order they merge
+	fetched bool     // whether the document was fetched since startup
+	gen     int      // incremented for each new document
+}
+
+// remoteFor returns the remote config of c, shared by the loggers using
+// the same URL.
+func remoteFor(c *Config) *remoteConfig {
+	url := expand(c.ConfigURL)
+	remotesMu.Lock()
+	defer remotesMu.Unlock()
+	r, ok := remotes[url]
+	if !ok {
+		r = &remoteConfig{url: url, cache: expand(c.ConfigCache)}
+		if r.cache == "" {
+			sum := sha256.Sum256([]byte(url))
+			r.cache = filepath.Join(cacheDir(), fmt.Sprintf("%s-remote-%x.json", appName(), sum[:8]))
+		}
+		remotes[url] = r
+	}
+	return r
+}
+
+// cacheDir returns the directory of the default cache files: log4g in the
+// user cache directory, else a private directory of the user in the temp
+// directory. One that another user could have made is not trusted.
+func cacheDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "log4g")
+	}
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("log4g-%d", os.Getuid()))
+	os.Mkdir(dir, 0700)
+	if fi, err := os.Lstat(dir); err == nil && fi.IsDir() && fi.Mode().Perm() == 0700 {
+		return dir
+	}
+	log.Printf("log4g: %s is not a private directory, the config cache lasts until exit", dir)
+	dir, _ = ioutil.TempDir("", "log4g-")
+	return dir
+}
+
+// load returns the last good documents: those fetched before, else the
+// cached ones. It returns nil if there are none yet; the poller fetches
+// them in the background.
+func (r *remoteConfig) load() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.data != nil {
+		return r.docs
+	}
+	data, err := ioutil.ReadFile(r.cache)
+	if err != nil {
+		return nil
+	}
+	var docs []json.RawMessage
+	if err := json.Unmarshal(data, &docs); err != nil {
+		log.Printf("log4g: invalid config cache %s: %v", r.cache, err)
+		return nil
+	}
+	r.data = data
+	r.docs = make([][]byte, len(docs))
+	for i, doc := range docs {
+		r.docs[i] = doc
+	}
+	if etag, err := ioutil.ReadFile(r.cache + ".etag"); err == nil {
+		r.etag = string(etag)
+	}
+	return r.docs
+}
+
+// poll fetches the documents and returns their generation. The requests
+// are made without holding r, so that loading a config never waits for
+// them.
+func (r *remoteConfig) poll() (int, error) {
+	r.mu.Lock()
+	etag := ""
+	if r.data != nil {
+		etag = r.etag
+	}
+	r.mu.Unlock()
+	docs, etag, err := fetchRemote(r.url, etag)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		return r.gen, err
+	}
+	r.fetched = true
+	if docs != nil {
+		r.update(docs, etag)
+	}
+	return r.gen, nil
+}
+
+// state returns the generation of the documents and whether they were
+// fetched since startup.
+func (r *remoteConfig) state() (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gen, r.fetched
+}
+
+// update keeps docs, and caches them, if they differ from the current ones.
+func (r *remoteConfig) update(docs [][]byte, etag string) {
+	raw := make([]json.RawMessage, len(docs))
+	for i, doc := range docs {
+		raw[i] = doc
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	r.etag = etag
+	if bytes.Equal(data, r.data) {
+		return
+	}
+	r.data = data
+	r.docs = docs
+	r.gen++
+	if err := writeCache(r.cache, data); err != nil {
+		log.Println(err)
+	}
+	if err := writeCache(r.cache+".etag", []byte(r.etag)); err != nil {
+		log.Println(err)
+	}
+}
+
+// writeCache replaces the file name with data through a temporary file in
+// its directory, created private, so that a reader never sees a partial file
+// and a link planted at name is replaced rather than followed.
+func writeCache(name string, data []byte) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// fetchRemote gets the document at u, and the documents it extends or
+// includes, unless etag is still its ETag, in which case it returns no
+// documents. The documents are returned only if they make a valid config.
+func fetchRemote(u, etag string) ([][]byte, string, error) {
+	data, etag, err := getRemote(u, etag)
+	if err != nil || data == nil {
+		return nil, etag, err
+	}
+	var docs [][]byte
+	if err := collectRemote(u, data, &docs, map[string]bool{u: true}); err != nil {
+		return nil, "", err
+	}
+	if err := validateConfigData(docs); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", u, err)
+	}
+	return docs, etag, nil
+}
+
+// getRemote gets the document at u. With an etag, it returns a nil document
+// if the document is unchanged.
+func getRemote(u, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, "", fmt.Errorf("%s: empty config", u)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// collectRemote appends to docs the document data at u in the order the
+// documents merge: those it extends, itself, then those it includes, all
+// fetched relative to u. seen guards against cycles.
+func collectRemote(u string, data []byte, docs *[][]byte, seen map[string]bool) error {
+	var head struct {
+		Extends []string `json:"extends"`
+		Include []string `json:"include"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return fmt.Errorf("%s: %v", u, err)
+	}
+	base, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	collect := func(refs []string) error {
+		for _, ref := range refs {
+			ru, err := base.Parse(ref)
+			if err != nil {
+				return fmt.Errorf("%s: %v", u, err)
+			}
+			next := ru.String()
+			if seen[next] {
+				return fmt.Errorf("log4g: config %s extends or includes itself", next)
+			}
+			seen[next] = true
+			data, _, err := getRemote(next, "")
+			if err == nil {
+				err = collectRemote(next, data, docs, seen)
+			}
+			delete(seen, next)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := collect(head.Extends); err != nil {
+		return err
+	}
+	*docs = append(*docs, data)
+	return collect(head.Include)
+}
+
+func validateConfigData(docs [][]byte) error {
+	c := NewConfig()
+	for _, data := range docs {
+		if err := mergeLayer(data, c); err != nil {
+			return err
+		}
+	}
+	return checkLevels(c)
+}
+
+// startPolling reloads l whenever its remote config changes, whichever
+// logger polled the change.
+func (l *Logger) startPolling() {
+	l.rw.RLock()
+	c := l.config
+	l.rw.RUnlock()
+	if c.ConfigURL == "" {
+		return
+	}
+	interval := defaultConfigPoll
+	if c.ConfigPoll != "" {
+		d, err := time.ParseDuration(c.ConfigPoll)
+		if err != nil || d <= 0 {
+			l.Warn("log4g: invalid config_poll %s", c.ConfigPoll)
+			return
+		}
+		interval = d
+	}
+	r := remoteFor(c)
+	gen, fetched := r.state()
+	stop := make(chan struct{})
+	l.mu.Lock()
+	l.pollStop = stop
+	l.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll := !fetched // the first poll is right away
+		for {
+			if poll {
+				g, err := r.poll()
+				if err != nil {
+					l.Warn("log4g: failed to poll the config: %v", err)
+				}
+				if g != gen {
+					select {
+					case <-stop:
+					default:
+						l.Reload()
+						l.Warn("log4g: reloaded the config from %s", r.url)
+					}
+					return
+				}
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				poll = true
+			}
+		}
+	}()
+}
+
+func (l *Logger) stopPolling() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pollStop != nil {
+		close(l.pollStop)
+		l.pollStop = nil
+	}
+}
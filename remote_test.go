@@ -0,0 +1,220 @@
+package log4g
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// configServer serves config documents by path, with their ETags, and
+// counts the full and the not-modified answers.
+type configServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	docs        map[string]string
+	delay       time.Duration
+	full        int
+	notModified int
+}
+
+func newConfigServer(docs map[string]string) *configServer {
+	s := &configServer{docs: docs}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		delay := s.delay
+		s.mu.Unlock()
+		time.Sleep(delay)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		doc, ok := s.docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := fmt.Sprintf(`"%d"`, len(doc))
+		if r.Header.Get("If-None-Match") == etag {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.full++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(doc))
+	}))
+	return s
+}
+
+func (s *configServer) set(path, doc string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[path] = doc
+}
+
+// waitFor waits until read returns a text holding s.
+func waitFor(t *testing.T, read func() string, s string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(read(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%q not written:\n%s", s, read())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// hasLine reports whether a line of text starts with prefix and holds s.
+func hasLine(text, prefix, s string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, prefix) && strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteLogger(t *testing.T, url, cache string) (*Logger, func() string, func()) {
+	return newFileLogger(t, `{
+		"prefix": "[file] ",
+		"items": [{"output": "file", "filename": "$OUT"}],
+		"config_url": "`+url+`",
+		"config_poll": "50ms",
+		"config_cache": "`+filepath.ToSlash(cache)+`"
+	}`)
+}
+
+func TestRemoteConfigPoll(t *testing.T) {
+	s := newConfigServer(map[string]string{
+		"/conf/base.json": `{"prefix": "[base] "}`,
+		"/conf/app.json":  `{"extends": ["base.json"], "level": "warn"}`,
+	})
+	defer s.Close()
+	s.delay = 300 * time.Millisecond
+	cache, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+
+	start := time.Now()
+	l, read, cleanup := remoteLogger(t, s.URL+"/conf/app.json", filepath.Join(cache, "remote.json"))
+	defer cleanup()
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("NewLogger waited %v for the remote config", d)
+	}
+
+	// the remote config, with the base it extends relative to its URL,
+	// applies once fetched
+	waitFor(t, func() string {
+		l.Warn("probe")
+		return read()
+	}, "[base] ")
+	l.Info("hidden")
+	if strings.Contains(read(), "hidden") {
+		t.Error("remote level not applied")
+	}
+
+	// unchanged documents are not sent again
+	s.mu.Lock()
+	s.delay = 0
+	s.mu.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	s.mu.Lock()
+	full, notModified := s.full, s.notModified
+	s.mu.Unlock()
+	if full != 2 || notModified == 0 {
+		t.Errorf("%d full answers and %d not modified, want 2 and some", full, notModified)
+	}
+
+	// a new document reloads the logger, an invalid one is ignored
+	s.set("/conf/app.json", `{"prefix": "[v2] ", "level": "warn"}`)
+	waitFor(t, func() string {
+		l.Warn("probe")
+		return read()
+	}, "[v2] ")
+	s.set("/conf/app.json", `{"level": "loud"}`)
+	time.Sleep(200 * time.Millisecond)
+	l.Warn("still v2")
+	if got := read(); !hasLine(got, "[v2] ", "still v2") {
+		t.Errorf("invalid remote config applied:\n%s", got)
+	}
+}
+
+func TestRemoteConfigCache(t *testing.T) {
+	s := newConfigServer(map[string]string{"/app.json": `{"prefix": "[remote] "}`})
+	url := s.URL + "/app.json"
+	cache, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	cacheFile := filepath.Join(cache, "remote.json")
+
+	l, read, cleanup := remoteLogger(t, url, cacheFile)
+	waitFor(t, func() string {
+		l.Info("probe")
+		return read()
+	}, "[remote] ")
+	cleanup()
+	s.Close()
+
+	// with the endpoint gone, a new process starts from the cache
+	remotesMu.Lock()
+	delete(remotes, url)
+	remotesMu.Unlock()
+	l, read, cleanup = remoteLogger(t, url, cacheFile)
+	defer cleanup()
+	l.Info("from cache")
+	if got := read(); !hasLine(got, "[remote] ", "from cache") {
+		t.Errorf("cached config not applied:\n%s", got)
+	}
+}
+
+func TestRemoteCacheNamedByURL(t *testing.T) {
+	a := remoteFor(&Config{ConfigURL: "http://config.test/a.json"})
+	b := remoteFor(&Config{ConfigURL: "http://config.test/b.json"})
+	if a.cache == b.cache {
+		t.Errorf("both URLs cached in %s", a.cache)
+	}
+}
+
+func TestRemoteCachePrivate(t *testing.T) {
+	r := remoteFor(&Config{ConfigURL: "http://config.test/private.json"})
+	if filepath.Dir(r.cache) == filepath.Clean(os.TempDir()) {
+		t.Errorf("cached in the temp directory: %s", r.cache)
+	}
+
+	// a link planted at the cache is replaced, its target left alone
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "target")
+	cache := filepath.Join(dir, "sub", "remote.json")
+	if err := ioutil.WriteFile(target, []byte("kept"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Dir(cache), 0700)
+	if err := os.Symlink(target, cache); err != nil {
+		t.Skip(err)
+	}
+	if err := writeCache(cache, []byte("[]")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(target); string(data) != "kept" {
+		t.Errorf("link target overwritten with %q", data)
+	}
+	fi, err := os.Lstat(cache)
+	if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm() != 0600 {
+		t.Errorf("cache %v: %v", fi.Mode(), err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Dir(cache)); len(entries) != 1 {
+		t.Errorf("%d files left next to the cache", len(entries))
+	}
+}
@@ -0,0 +1,82 @@
+package log4g
+
+import (
+	"os"
+	"os/signal"
+)
+
+// HandleSignals makes the default logger handle signals, see
+// Logger.HandleSignals.
+func HandleSignals() {
+	exportLoggers.HandleSignals()
+}
+
+// HandleSignals installs signal handlers until Close:
+//
+//	SIGHUP   reloads every logger from the files it was created with
+//	SIGUSR1  raises the level INFO -> DEBUG -> TRACE, then back to the
+//	         level before the first raise
+//	SIGUSR2  reopens the files of the items
+//
+// SIGUSR1 and SIGUSR2 do not exist on Windows. Each change is logged at
+// WARN whatever the levels, so that it is seen even at ERROR.
+func (l *Logger) HandleSignals() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.signals != nil {
+		return
+	}
+	l.signals = make(chan os.Signal, 1)
+	signal.Notify(l.signals, handledSignals...)
+	go func(signals chan os.Signal) {
+		for sig := range signals {
+			l.handleSignal(sig)
+		}
+	}(l.signals)
+}
+
+func (l *Logger) stopSignals() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.signals != nil {
+		signal.Stop(l.signals)
+		close(l.signals)
+		l.signals = nil
+	}
+}
+
+func (l *Logger) handleSignal(sig os.Signal) {
+	switch sig {
+	case reloadSignal:
+		reloadAll()
+		l.notice("log4g: reloaded the config on %v", sig)
+	case levelSignal:
+		l.cycleLevel(sig)
+	case reopenSignal:
+		if err := l.Reopen(); err != nil {
+			l.Error("log4g: failed to reopen the files on %v: %v", sig, err)
+		} else {
+			l.notice("log4g: reopened the files on %v", sig)
+		}
+	}
+}
+
+// cycleLevel raises the level to DEBUG, then TRACE, then restores it.
+func (l *Logger) cycleLevel(sig os.Signal) {
+	level := l.GetLevel()
+	switch {
+	case level < LEVEL_DEBUG:
+		l.sigBase = l.getArgLevel()
+		l.SetLevel(LEVEL_DEBUG)
+	case level < LEVEL_TRACE:
+		if l.getArgLevel() != LEVEL_DEBUG {
+			l.sigBase = l.getArgLevel()
+		}
+		l.SetLevel(LEVEL_TRACE)
+	default:
+		l.notice("log4g: restoring the level on %v", sig)
+		l.SetLevel(l.sigBase)
+		return
+	}
+	l.notice("log4g: level set to %v on %v", l.GetLevel(), sig)
+}
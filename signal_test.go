@@ -0,0 +1,78 @@
+//go:build !windows
+// +build !windows
+
+package log4g
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignals(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"level": "info", "items": [{"output": "file", "filename": "$OUT"}]}`)
+	defer cleanup()
+	l.HandleSignals()
+	out := l.items[0].(*FileLoggerItem).filename
+
+	raise := func(sig syscall.Signal, want Level) {
+		if err := syscall.Kill(os.Getpid(), sig); err != nil {
+			t.Fatal(err)
+		}
+		waitLevel(t, l.GetLevel, want)
+	}
+	raise(syscall.SIGUSR1, LEVEL_DEBUG)
+	l.Debug("debug on")
+	raise(syscall.SIGUSR1, LEVEL_TRACE)
+	l.Trace("trace on")
+	raise(syscall.SIGUSR1, LEVEL_INFO)
+	l.Debug("debug off")
+
+	got := read()
+	for _, s := range []string{"debug on", "trace on", "level set to DEBUG on user defined signal 1"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not written:\n%s", s, got)
+		}
+	}
+	if strings.Contains(got, "debug off") {
+		t.Errorf("level not restored:\n%s", got)
+	}
+
+	// SIGUSR2 reopens the file moved away
+	if err := os.Rename(out, out+".old"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if data, _ := ioutil.ReadFile(out); strings.Contains(string(data), "reopened the files") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("file not reopened on SIGUSR2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSignalNoticeAtError(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"level": "error", "items": [{"output": "file", "filename": "$OUT", "level": "error"}]}`)
+	defer cleanup()
+	l.HandleSignals()
+
+	// the notice passes the levels, which would filter a WARN record
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(read(), "WARN signal.go") {
+		if time.Now().After(deadline) {
+			t.Fatalf("notice not written at ERROR:\n%s", read())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := read(); !strings.Contains(got, "reopened the files") {
+		t.Errorf("notice:\n%s", got)
+	}
+}
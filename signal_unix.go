@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package log4g
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	reloadSignal   os.Signal = syscall.SIGHUP
+	levelSignal    os.Signal = syscall.SIGUSR1
+	reopenSignal   os.Signal = syscall.SIGUSR2
+	handledSignals           = []os.Signal{reloadSignal, levelSignal, reopenSignal}
+)
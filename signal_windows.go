@@ -0,0 +1,13 @@
+package log4g
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	reloadSignal   os.Signal = syscall.SIGHUP
+	levelSignal    os.Signal
+	reopenSignal   os.Signal
+	handledSignals = []os.Signal{reloadSignal}
+)
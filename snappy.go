@@ -0,0 +1,78 @@
+package log4g
+
+import "encoding/binary"
+
+const (
+	snappyBlockSize = 1 << 16
+	snappyTableBits = 14
+)
+
+// snappyEncode returns src compressed in the snappy block format, as the
+// Loki and Prometheus remote APIs expect. Matches are looked up within
+// blocks of 64KB, so every copy fits a 2 byte offset.
+func snappyEncode(src []byte) []byte {
+	var n [binary.MaxVarintLen64]byte
+	dst := make([]byte, 0, len(src)/2+16)
+	dst = append(dst, n[:binary.PutUvarint(n[:], uint64(len(src)))]...)
+	for len(src) > 0 {
+		block := src
+		if len(block) > snappyBlockSize {
+			block = block[:snappyBlockSize]
+		}
+		src = src[len(block):]
+		dst = snappyEncodeBlock(dst, block)
+	}
+	return dst
+}
+
+func snappyEncodeBlock(dst, src []byte) []byte {
+	var table [1 << snappyTableBits]uint16
+	lit := 0 // the start of the bytes not encoded yet
+	for i := 0; i+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := (v * 0x1e35a7bd) >> (32 - snappyTableBits)
+		c := int(table[h])
+		table[h] = uint16(i)
+		if c >= i || binary.LittleEndian.Uint32(src[c:]) != v {
+			i++
+			continue
+		}
+		j := i + 4
+		for j < len(src) && src[j] == src[c+j-i] {
+			j++
+		}
+		dst = appendSnappyLiteral(dst, src[lit:i])
+		dst = appendSnappyCopy(dst, i-c, j-i)
+		i, lit = j, j
+	}
+	return appendSnappyLiteral(dst, src[lit:])
+}
+
+func appendSnappyLiteral(dst, lit []byte) []byte {
+	n := len(lit) - 1
+	switch {
+	case n < 0:
+		return dst
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	default:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	}
+	return append(dst, lit...)
+}
+
+// appendSnappyCopy appends copies of length bytes, at least 4, from offset
+// bytes back.
+func appendSnappyCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	return append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+}
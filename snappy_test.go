@@ -0,0 +1,101 @@
+package log4g
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// snappyDecode decompresses a snappy block, to check snappyEncode.
+func snappyDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errors.New("snappy: bad length")
+	}
+	src = src[n:]
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errors.New("snappy: short literal length")
+				}
+				length = 0
+				for i := extra - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			length++
+			if len(src) < length {
+				return nil, errors.New("snappy: short literal")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errors.New("snappy: short copy")
+			}
+			length = 4 + int(tag>>2)&7
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errors.New("snappy: short copy")
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errors.New("snappy: short copy")
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errors.New("snappy: bad offset")
+		}
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, errors.New("snappy: bad decoded length")
+	}
+	return dst, nil
+}
+
+func TestSnappyRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	for name, src := range map[string][]byte{
+		"empty":        {},
+		"short":        []byte("abc"),
+		"record":       []byte(`{"streams":[{"stream":{"app":"a"},"values":[["1","one"],["2","one"]]}]}`),
+		"runs":         bytes.Repeat([]byte("log4g "), 30000),
+		"random":       random,
+		"long literal": append(append([]byte{}, random[:300]...), bytes.Repeat([]byte{'x'}, 200)...),
+	} {
+		enc := snappyEncode(src)
+		dec, err := snappyDecode(enc)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !bytes.Equal(dec, src) {
+			t.Errorf("%s: decoded %d bytes differ from the %d encoded", name, len(dec), len(src))
+		}
+		if name == "runs" && len(enc) > len(src)/10 {
+			t.Errorf("%s: %d bytes compressed to %d", name, len(src), len(enc))
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package log4g
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolExt         = ".spool"
+	spoolSegmentSize = 4 * 1024 * 1024
+	// a record is its length, the crc32 of its data, the unix time in
+	// nanoseconds it was spooled at, then its data
+	spoolHeader = 16
+)
+
+var errSpoolCorrupt = errors.New("log4g: corrupt spool record")
+
+// spool keeps on disk the records a network item failed to deliver, in
+// segment files of checksummed records, and replays them in order once the
+// item delivers again. A segment is named after its sequence number while
+// it is written, then after its sequence number and the count of its
+// records, so it can be discarded without being read. While records wait in the spool the new ones queue
+// behind them. Delivery is at least once: a record may be sent again if the
+// process stops while replaying.
+type spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	item    *GenericLoggerItem
+	send    func(p []byte) error
+	mu      sync.Mutex // protects the following fields
+	seq     uint64     // of the last segment
+	cur     *os.File   // the segment records are appended to
+	curSize int64
+	curRecs int64 // in cur
+	size    int64 // of all the segments
+	pending bool  // records wait in the spool
+	started bool
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newSpool returns the spool configured by lc for item, or nil if lc has
+// none.
+func newSpool(lc *loggerConfig, item *GenericLoggerItem, send func(p []byte) error) (*spool, error) {
+	if lc.Spool == "" {
+		return nil, nil
+	}
+	s := &spool{
+		dir:     lc.Spool,
+		maxSize: lc.SpoolMaxSize * 1024 * 1024,
+		item:    item,
+		send:    send,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if lc.SpoolMaxAge != "" {
+		d, err := time.ParseDuration(lc.SpoolMaxAge)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("log4g: invalid spool_max_age %s", lc.SpoolMaxAge)
+		}
+		s.maxAge = d
+	}
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segs {
+		if info, err := os.Stat(seg); err == nil {
+			s.size += info.Size()
+		}
+	}
+	if len(segs) > 0 {
+		s.seq = segmentSeq(segs[len(segs)-1])
+		s.pending = true
+	}
+	return s, nil
+}
+
+// segments returns the segment files in the order they were written.
+func (s *spool) segments() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), spoolExt) && segmentSeq(f.Name()) > 0 {
+			segs = append(segs, filepath.Join(s.dir, f.Name()))
+		}
+	}
+	sort.Strings(segs)
+	return segs, nil
+}
+
+func segmentSeq(name string) uint64 {
+	base := strings.TrimSuffix(filepath.Base(name), spoolExt)
+	if i := strings.IndexByte(base, '-'); i >= 0 {
+		base = base[:i]
+	}
+	seq, _ := strconv.ParseUint(base, 10, 64)
+	return seq
+}
+
+// segmentRecords returns the count of records in the name of a segment, or
+// -1 if the name has none: the segment was being written when the process
+// stopped.
+func segmentRecords(name string) int64 {
+	base := strings.TrimSuffix(filepath.Base(name), spoolExt)
+	i := strings.IndexByte(base, '-')
+	if i < 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(base[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// segmentName returns the name of the segment seq of dir, holding n records
+// or being written if n is negative.
+func segmentName(dir string, seq uint64, n int64) string {
+	if n < 0 {
+		return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+	}
+	return filepath.Join(dir, fmt.Sprintf("%020d-%d%s", seq, n, spoolExt))
+}
+
+// start starts the replayer, which replays at once the records a previous
+// spool left. The item calls it once it has its metrics.
+func (s *spool) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		s.started = true
+		if s.pending {
+			s.notify()
+		}
+		go s.run()
+	}
+}
+
+// close stops the replayer and closes the segment being written. The
+// records left are replayed by the next spool on the same directory.
+func (s *spool) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		close(s.stop)
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeSegment()
+}
+
+// notify wakes the replayer, for instance once the item delivers again.
+func (s *spool) notify() {
+	if s == nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// write delivers p with send unless records wait in the spool, and spools
+// it if the delivery fails.
+func (s *spool) write(p []byte, send func(p []byte) error) (n int, err error) {
+	s.mu.Lock()
+	pending := s.pending
+	s.mu.Unlock()
+	if !pending {
+		if err = send(p); err == nil {
+			return len(p), nil
+		}
+		s.item.health.fail(err)
+	}
+	if err = s.append(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *spool) append(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil || s.curSize >= spoolSegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	rec := make([]byte, spoolHeader+len(p))
+	binary.BigEndian.PutUint32(rec[0:], uint32(len(p)))
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(p))
+	binary.BigEndian.PutUint64(rec[8:], uint64(time.Now().UnixNano()))
+	copy(rec[spoolHeader:], p)
+	if _, err := s.cur.Write(rec); err != nil {
+		return err
+	}
+	s.curSize += int64(len(rec))
+	s.curRecs++
+	s.size += int64(len(rec))
+	s.item.metrics.spooled()
+	if !s.pending {
+		s.pending = true
+		s.notify()
+	}
+	s.trim()
+	return nil
+}
+
+// rotate starts a new segment, after removing the segments older than
+// maxAge.
+func (s *spool) rotate() error {
+	s.closeSegment()
+	if s.maxAge > 0 {
+		segs, _ := s.segments()
+		for _, seg := range segs {
+			if info, err := os.Stat(seg); err == nil && time.Since(info.ModTime()) > s.maxAge {
+				s.discard(seg, info.Size())
+			}
+		}
+	}
+	s.seq++
+	f, err := os.OpenFile(segmentName(s.dir, s.seq, -1), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		return err
+	}
+	s.cur = f
+	s.curSize = 0
+	s.curRecs = 0
+	return nil
+}
+
+// closeSegment closes the segment being written and names it after the
+// count of its records.
+func (s *spool) closeSegment() {
+	if s.cur == nil {
+		return
+	}
+	s.cur.Close()
+	if err := os.Rename(s.cur.Name(), segmentName(s.dir, s.seq, s.curRecs)); err != nil {
+		s.item.health.fail(err)
+	}
+	s.cur = nil
+}
+
+// trim removes the oldest segments while the spool is over maxSize. The
+// segment being written is kept.
+func (s *spool) trim() {
+	if s.maxSize <= 0 || s.size <= s.maxSize {
+		return
+	}
+	segs, _ := s.segments()
+	for _, seg := range segs {
+		if s.size <= s.maxSize || s.cur != nil && seg == s.cur.Name() {
+			return
+		}
+		if info, err := os.Stat(seg); err == nil {
+			s.discard(seg, info.Size())
+		}
+	}
+}
+
+// discard removes a segment of size bytes and counts its records. Only a
+// segment left unnamed by a stopped process is read to count them.
+func (s *spool) discard(seg string, size int64) {
+	count := segmentRecords(seg)
+	if count < 0 {
+		data, _ := ioutil.ReadFile(seg)
+		count = countSpoolRecords(data)
+	}
+	if os.Remove(seg) != nil {
+		return
+	}
+	s.size -= size
+	s.item.metrics.discarded(count)
+}
+
+// countSpoolRecords returns the count of records in data, where the part
+// that cannot be framed counts as one.
+func countSpoolRecords(data []byte) int64 {
+	var count int64
+	for len(data) > 0 {
+		count++
+		_, _, n, err := decodeSpoolRecord(data)
+		if err != nil {
+			break
+		}
+		data = data[n:]
+	}
+	return count
+}
+
+// decodeSpoolRecord returns the data and time of the record at the start of
+// b, and the length of the record.
+func decodeSpoolRecord(b []byte) (p []byte, t time.Time, n int, err error) {
+	if len(b) < spoolHeader {
+		return nil, t, 0, errSpoolCorrupt
+	}
+	size := int(binary.BigEndian.Uint32(b[0:]))
+	if size > len(b)-spoolHeader {
+		return nil, t, 0, errSpoolCorrupt
+	}
+	p = b[spoolHeader : spoolHeader+size]
+	if crc32.ChecksumIEEE(p) != binary.BigEndian.Uint32(b[4:]) {
+		return nil, t, 0, errSpoolCorrupt
+	}
+	t = time.Unix(0, int64(binary.BigEndian.Uint64(b[8:])))
+	return p, t, spoolHeader + size, nil
+}
+
+// run replays the spool when records are spooled, and retries with a
+// growing delay while the delivery fails. It sleeps while the spool is
+// empty.
+func (s *spool) run() {
+	defer close(s.done)
+	backoff := minRetry
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-retry:
+		}
+		if s.drain() {
+			backoff = minRetry
+			retry = nil
+			continue
+		}
+		retry = time.After(jitter(backoff))
+		if backoff *= 2; backoff > maxRetry {
+			backoff = maxRetry
+		}
+	}
+}
+
+// drain replays the segments in order until the spool is empty. It reports
+// false if a delivery failed.
+func (s *spool) drain() bool {
+	for {
+		s.mu.Lock()
+		if !s.pending {
+			s.mu.Unlock()
+			return true
+		}
+		// new records go to a new segment while these are replayed
+		s.closeSegment()
+		segs, err := s.segments()
+		if err == nil && len(segs) == 0 {
+			s.pending = false
+		}
+		s.mu.Unlock()
+		if err != nil {
+			s.item.health.fail(err)
+			return false
+		}
+		for _, seg := range segs {
+			select {
+			case <-s.stop:
+				return true
+			default:
+			}
+			if !s.replay(seg) {
+				return false
+			}
+		}
+	}
+}
+
+// replay sends the records of seg and removes it. If a delivery fails, seg
+// keeps the records not delivered yet.
+func (s *spool) replay(seg string) bool {
+	data, err := ioutil.ReadFile(seg)
+	if err != nil {
+		s.item.health.fail(err)
+		return false
+	}
+	size := int64(len(data))
+	metrics := s.item.metrics
+	for len(data) > 0 {
+		p, t, n, err := decodeSpoolRecord(data)
+		if err != nil {
+			// the rest of the segment cannot be framed
+			s.item.health.fail(fmt.Errorf("%s: %v", seg, err))
+			metrics.discarded(1)
+			break
+		}
+		if s.maxAge > 0 && time.Since(t) > s.maxAge {
+			metrics.discarded(1)
+		} else if err := s.send(p); err != nil {
+			s.item.health.fail(err)
+			if len(data) < int(size) {
+				s.keep(seg, data, size)
+			}
+			return false
+		} else {
+			metrics.replayed()
+		}
+		data = data[n:]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if os.Remove(seg) == nil {
+		s.size -= size
+	}
+	return true
+}
+
+// keep replaces seg of size bytes with the records left in data, in a
+// segment of the same sequence named after their count.
+func (s *spool) keep(seg string, data []byte, size int64) {
+	tmp := seg + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0660); err != nil {
+		s.item.health.fail(err)
+		return
+	}
+	kept := segmentName(s.dir, segmentSeq(seg), countSpoolRecords(data))
+	if err := os.Rename(tmp, kept); err != nil {
+		s.item.health.fail(err)
+		return
+	}
+	if kept != seg {
+		os.Remove(seg)
+	}
+	s.mu.Lock()
+	s.size -= size - int64(len(data))
+	s.mu.Unlock()
+}
@@ -0,0 +1,124 @@
+package log4g
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// collector records the records a spool replays.
+type collector struct {
+	mu   sync.Mutex
+	recs []string
+}
+
+func (c *collector) send(p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recs = append(c.recs, string(p))
+	return nil
+}
+
+func (c *collector) records() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.recs, ",")
+}
+
+func down(p []byte) error {
+	return errors.New("down")
+}
+
+func newTestSpool(t *testing.T, dir string, send func(p []byte) error) *spool {
+	s, err := newSpool(&loggerConfig{Spool: dir}, &GenericLoggerItem{metrics: &itemMetrics{}}, send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSpoolReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &collector{}
+	s := newTestSpool(t, dir, c.send)
+	s.start()
+
+	// a spooled record wakes the replayer, which does not wait for a retry
+	start := time.Now()
+	s.write([]byte("a"), down)
+	s.write([]byte("b"), down)
+	waitFor(t, c.records, "a,b")
+	if d := time.Since(start); d >= minRetry {
+		t.Errorf("replayed after %v", d)
+	}
+	s.close()
+	if segs, _ := s.segments(); len(segs) != 0 {
+		t.Errorf("segments %v left", segs)
+	}
+	m := s.item.metrics
+	if atomic.LoadInt64(&m.spools) != 2 || atomic.LoadInt64(&m.replays) != 2 {
+		t.Errorf("%d spooled and %d replayed, want 2", m.spools, m.replays)
+	}
+
+	// the records a closed spool left are replayed by the next one
+	s = newTestSpool(t, dir, down)
+	s.write([]byte("c"), down)
+	s.close()
+	s = newTestSpool(t, dir, c.send)
+	s.start()
+	defer s.close()
+	waitFor(t, c.records, "a,b,c")
+}
+
+func TestSpoolDiscard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newTestSpool(t, dir, down)
+	for _, p := range []string{"a", "b", "c"} {
+		s.write([]byte(p), down)
+	}
+	s.close()
+	segs, _ := s.segments()
+	if len(segs) != 1 || segmentRecords(segs[0]) != 3 {
+		t.Fatalf("segments %v, want one of 3 records", segs)
+	}
+
+	// a closed segment is counted by its name, not read
+	if err := ioutil.WriteFile(segs[0], []byte("garbage"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSpool(t, dir, down)
+	s.mu.Lock()
+	s.discard(segs[0], 7)
+	s.mu.Unlock()
+	if n := atomic.LoadInt64(&s.item.metrics.discards); n != 3 {
+		t.Errorf("%d discarded, want 3", n)
+	}
+
+	// the segment being written when the process stopped is read
+	s.write([]byte("d"), down)
+	s.write([]byte("e"), down)
+	seg := s.cur.Name()
+	if filepath.Base(seg) != filepath.Base(segmentName(dir, s.seq, -1)) {
+		t.Fatalf("segment %s being written", seg)
+	}
+	s.mu.Lock()
+	s.discard(seg, s.curSize)
+	s.mu.Unlock()
+	if n := atomic.LoadInt64(&s.item.metrics.discards); n != 5 {
+		t.Errorf("%d discarded, want 5", n)
+	}
+}
@@ -0,0 +1,50 @@
+package log4g
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConfig returns the client config of a "tls" socket item. The files are
+// read on each call, so a reload picks up renewed certificates. The server
+// name defaults to the host of the address dialed.
+func tlsConfig(lc *loggerConfig) (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName: lc.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if lc.TLSMinVersion != "" {
+		v, ok := tlsVersions[lc.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("log4g: invalid tls_min_version %s", lc.TLSMinVersion)
+		}
+		c.MinVersion = v
+	}
+	if lc.TLSCA != "" {
+		pem, err := ioutil.ReadFile(lc.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("log4g: no certificate in %s", lc.TLSCA)
+		}
+	}
+	if lc.TLSCert != "" || lc.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(lc.TLSCert, lc.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
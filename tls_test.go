@@ -0,0 +1,176 @@
+package log4g
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert issues a certificate for tmpl signed by parent, or self-signed if
+// parent is nil, and writes it and its key to dir/name.crt and dir/name.key.
+func testCert(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.Subject = pkix.Name{CommonName: name}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Leaf, _ = x509.ParseCertificate(der)
+	return cert
+}
+
+// testPKI writes a CA, a server certificate for 127.0.0.1 and a client
+// certificate to dir, and returns a listener requiring client certificates
+// from the CA, with the lines it receives.
+func testPKI(t *testing.T, dir string) (net.Listener, chan string) {
+	ca := testCert(t, dir, "ca", &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	server := testCert(t, dir, "server", &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	testCert(t, dir, "client", &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					lines <- sc.Text()
+				}
+			}()
+		}
+	}()
+	return ln, lines
+}
+
+func newTLSLogger(t *testing.T, dir, address, ca string) *Logger {
+	conf := filepath.Join(dir, "tls.json")
+	err := ioutil.WriteFile(conf, []byte(`{"flag":"","items":[{"name":"tls","output":"socket","network":"tls",
+		"address":"`+address+`","tls_ca":"`+ca+`","tls_min_version":"1.2",
+		"tls_cert":"`+filepath.Join(dir, "client.crt")+`","tls_key":"`+filepath.Join(dir, "client.key")+`"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLogger(conf)
+}
+
+func TestTLSSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ln, lines := testPKI(t, dir)
+	defer ln.Close()
+
+	l := newTLSLogger(t, dir, ln.Addr().String(), filepath.Join(dir, "ca.crt"))
+	defer l.Close()
+	waitConnected(t, l)
+	l.Info("over tls")
+	select {
+	case line := <-lines:
+		if line != " INFO over tls" {
+			t.Errorf("got %q", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no record received")
+	}
+}
+
+func TestTLSSocketUnknownCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ln, _ := testPKI(t, dir)
+	defer ln.Close()
+	other := filepath.Join(dir, "other")
+	os.Mkdir(other, 0755)
+	testCert(t, other, "ca", &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+
+	l := newTLSLogger(t, dir, ln.Addr().String(), filepath.Join(other, "ca.crt"))
+	defer l.Close()
+	l.SetErrorHandler(func(item string, err error) {})
+	waitStatus(t, l, "stopped")
+	l.Info("rejected")
+}
+
+func TestTLSSocketReopenReadsFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ln, lines := testPKI(t, dir)
+	defer ln.Close()
+	os.Rename(filepath.Join(dir, "client.key"), filepath.Join(dir, "client.key.new"))
+
+	l := newTLSLogger(t, dir, ln.Addr().String(), filepath.Join(dir, "ca.crt"))
+	defer l.Close()
+	l.SetErrorHandler(func(item string, err error) {})
+	if h := l.Health(); h[0].Status != "stopped" {
+		t.Fatalf("health %+v, want stopped without the key", h[0])
+	}
+	os.Rename(filepath.Join(dir, "client.key.new"), filepath.Join(dir, "client.key"))
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	// the item resumes once the connector dialed again
+	waitStatus(t, l, "")
+	l.Info("after reopen")
+	select {
+	case line := <-lines:
+		if line != " INFO after reopen" {
+			t.Errorf("got %q", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no record received")
+	}
+}
@@ -0,0 +1,144 @@
+package log4g
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// vmodule holds per-file levels like "db/*=TRACE,cache.go=DEBUG". A pattern
+// without a slash matches the file name, one with slashes matches as many
+// trailing path elements; the ".go" suffix is optional. The first matching
+// pattern wins.
+type vmodule struct {
+	rules []vmoduleRule
+	cache sync.Map // call site pc -> vmoduleLevel
+}
+
+type vmoduleRule struct {
+	pattern string
+	level   Level
+}
+
+type vmoduleLevel struct {
+	level Level
+	ok    bool
+}
+
+// parseVmodule returns nil for an empty spec.
+func parseVmodule(spec string) (*vmodule, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	v := new(vmodule)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.LastIndexByte(part, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid vmodule %s", part)
+		}
+		var level Level
+		if err := level.Set(part[i+1:]); err != nil {
+			return nil, err
+		}
+		pattern := strings.TrimSuffix(part[:i], ".go")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid vmodule pattern %s", part[:i])
+		}
+		v.rules = append(v.rules, vmoduleRule{pattern, level})
+	}
+	return v, nil
+}
+
+// levelAt returns the level for the call site skip frames above the caller
+// of levelAt, resolved once per pc.
+func (v *vmodule) levelAt(skip int) (Level, bool) {
+	if v == nil || len(v.rules) == 0 {
+		return 0, false
+	}
+	var pcs [1]uintptr
+	if runtime.Callers(skip, pcs[:]) == 0 {
+		return 0, false
+	}
+	if cached, ok := v.cache.Load(pcs[0]); ok {
+		vl := cached.(vmoduleLevel)
+		return vl.level, vl.ok
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	var vl vmoduleLevel
+	vl.level, vl.ok = v.match(frame.File)
+	v.cache.Store(pcs[0], vl)
+	return vl.level, vl.ok
+}
+
+func (v *vmodule) match(file string) (Level, bool) {
+	elems := strings.Split(strings.TrimSuffix(file, ".go"), "/")
+	for _, r := range v.rules {
+		n := strings.Count(r.pattern, "/") + 1
+		name := elems
+		if len(name) > n {
+			name = name[len(name)-n:]
+		}
+		if ok, _ := path.Match(r.pattern, strings.Join(name, "/")); ok {
+			return r.level, true
+		}
+	}
+	return 0, false
+}
+
+// Verbose is returned by V. Its methods log only if the verbosity is
+// enabled at the call site of V.
+type Verbose struct {
+	l       *Logger
+	enabled bool
+}
+
+// V reports whether verbosity n is enabled at the call site: the level there,
+// from vmodule or else the logger, is at least LEVEL_DEBUG+n. DEBUG enables
+// V(0), a level of 603 enables up to V(3) and TRACE up to V(100).
+func (l *Logger) V(n int) Verbose {
+	return l.v(n, 4)
+}
+
+func (l *Logger) v(n int, skip int) Verbose {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	level, ok := l.vmodule.levelAt(skip)
+	if !ok {
+		level = l.getLevel()
+	}
+	return Verbose{l, level >= LEVEL_DEBUG+Level(n)}
+}
+
+func (v Verbose) Enabled() bool {
+	return v.enabled
+}
+
+func (v Verbose) Log(level Level, arg interface{}, args ...interface{}) {
+	if v.enabled {
+		v.l.log(4, level, arg, args...)
+	}
+}
+
+func (v Verbose) Info(arg interface{}, args ...interface{}) {
+	if v.enabled {
+		v.l.log(4, LEVEL_INFO, arg, args...)
+	}
+}
+
+func (v Verbose) Debug(arg interface{}, args ...interface{}) {
+	if v.enabled {
+		v.l.log(4, LEVEL_DEBUG, arg, args...)
+	}
+}
+
+func (v Verbose) Trace(arg interface{}, args ...interface{}) {
+	if v.enabled {
+		v.l.log(4, LEVEL_TRACE, arg, args...)
+	}
+}
@@ -0,0 +1,77 @@
+package log4g
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestVmodule(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{
+		"level": "info",
+		"vmodule": "other.go=TRACE,*/vmodule_test=602",
+		"items": [{"output": "file", "filename": "$OUT", "level": "warn"}]
+	}`)
+	defer cleanup()
+	l.Debug("debug here")
+	l.Trace("trace hidden")
+	l.V(2).Info("v2 here")
+	l.V(3).Info("v3 hidden")
+	if !l.V(2).Enabled() || l.V(3).Enabled() {
+		t.Error("V enabled up to the wrong verbosity")
+	}
+
+	got := read()
+	for _, s := range []string{"debug here", "v2 here"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not written:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{"trace hidden", "v3 hidden"} {
+		if strings.Contains(got, s) {
+			t.Errorf("%q written:\n%s", s, got)
+		}
+	}
+}
+
+func TestParseVmodule(t *testing.T) {
+	for _, spec := range []string{"db", "db=LOUD", "[=TRACE"} {
+		if _, err := parseVmodule(spec); err == nil {
+			t.Errorf("no error for %q", spec)
+		}
+	}
+	v, err := parseVmodule("db/*=TRACE, cache.go=DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]Level{
+		"/src/app/db/conn.go": LEVEL_TRACE,
+		"/src/app/cache.go":   LEVEL_DEBUG,
+		"/src/app/main.go":    0,
+	} {
+		if level, _ := v.match(file); level != want {
+			t.Errorf("match(%s) = %v, want %v", file, level, want)
+		}
+	}
+}
+
+func TestVmoduleFlag(t *testing.T) {
+	l, read, cleanup := newFileLogger(t, `{"level": "info", "items": [{"output": "file", "filename": "$OUT"}]}`)
+	defer cleanup()
+	defer func() {
+		gArgs.vmodule = ""
+		reloadAll()
+	}()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"-log4g.vmodule=vmodule_test=TRACE"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Trace("traced")
+	if got := read(); !strings.Contains(got, "traced") {
+		t.Errorf("-log4g.vmodule not applied:\n%s", got)
+	}
+}